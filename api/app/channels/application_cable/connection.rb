@@ -2,8 +2,12 @@ module ApplicationCable
   class Connection < ActionCable::Connection::Base
     identified_by :connection_identifier
 
+    # ブラウザのAccept-Language（コマンド実行サーバーでメッセージの言語を選ぶために転送する）
+    attr_reader :accept_language
+
     def connect
       self.connection_identifier = SecureRandom.uuid
+      @accept_language = request.headers["Accept-Language"]
     end
   end
 end
@@ -6,7 +6,7 @@ class CommandChannel < ApplicationCable::Channel
   def subscribed
     # connection.connection_identifier は各クライアントに一意の識別子を割り当て
     # これにより、クライアントごとに独立したチャンネルで通信が可能
-    stream_from "command_channel_#{connection.connection_identifier}"
+    stream_from stream_name
   end
 
   # クライアントがチャンネルから切断された時に呼ばれる
@@ -22,13 +22,21 @@ class CommandChannel < ApplicationCable::Channel
 
     # CommandExecutorService を使用してコマンドを実行
     # このサービスは Redis を通じて実際のコマンド実行を行う
-    result = CommandExecutorService.execute(data["command"])
+    # 接続時のAccept-Languageを渡し、メッセージをブラウザの言語で返す
+    # 実行中に届いたセッションへの通知は、実行結果とは別にその都度クライアントへ送信する
+    result = CommandExecutorService.execute(data["command"], accept_language: connection.accept_language) do |notice|
+      ActionCable.server.broadcast(stream_name, notice)
+    end
 
     # 実行結果を、リクエストを送信したクライアントのみに送信
     # これにより、他のクライアントの結果が混ざることを防止
-    ActionCable.server.broadcast(
-      "command_channel_#{connection.connection_identifier}",
-      result
-    )
+    ActionCable.server.broadcast(stream_name, result)
+  end
+
+  private
+
+  # リクエストを送信したクライアントのみが購読しているストリーム名
+  def stream_name
+    "command_channel_#{connection.connection_identifier}"
   end
 end
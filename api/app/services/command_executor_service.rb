@@ -10,11 +10,15 @@ class CommandExecutorService
   # コマンド送信用と結果受信用の2つのチャンネルを使用
   COMMAND_CHANNEL = "terminal:commands"  # コマンドを送信するチャンネル
   RESULT_CHANNEL = "terminal:results"    # 結果を受信するチャンネル
-  TIMEOUT_SECONDS = 10  # コマンド実行のタイムアウト時間（秒）
+  # 結果を待つ時間（秒）
+  # ターミナルサーバーのコマンドのタイムアウト（command-timeout、デフォルト8秒）より長くし、
+  # タイムアウトしたコマンドのエラーを受け取れるようにする
+  TIMEOUT_SECONDS = ENV.fetch("TERMINAL_RESULT_TIMEOUT", 10).to_i
 
   # クラスメソッドとして実行を提供
-  def self.execute(command)
-    new.execute(command)
+  # ブロックを渡すと、結果を待つ間に受信したセッションへの通知（status: "notice"）をブロックに渡す
+  def self.execute(command, accept_language: nil, &on_notice)
+    new.execute(command, accept_language: accept_language, &on_notice)
   end
 
   # コマンド実行のメインロジック
@@ -22,7 +26,7 @@ class CommandExecutorService
   # 2. コマンドを送信
   # 3. 結果を待機
   # 4. 結果を返却
-  def execute(command)
+  def execute(command, accept_language: nil, &on_notice)
     Rails.logger.info "コマンド実行開始: #{command}"
 
     # コマンドデータからセッションIDを抽出
@@ -43,14 +47,28 @@ class CommandExecutorService
       Rails.logger.info "Redis接続テスト成功"
     rescue => e
       Rails.logger.error "Redis接続テスト失敗: #{e.message}"
-      return { status: "error", command: command, error: "Redis接続エラー: #{e.message}" }
+      return { status: "error", command: command, error: "Redis接続エラー: #{e.message}", error_code: "INTERNAL_ERROR" }
     end
 
+    # 結果チャンネルにはシャットダウン・管理APIからの通知（status: "notice"）や他のリクエストの結果も流れるため、
+    # リクエストIDを付けて送信し、同じリクエストIDの結果のみを返信として受け取る
+    request_id = command_data["request_id"].presence || SecureRandom.uuid
+
     # コマンドをJSON形式で送信（クライアントのセッションIDを維持）
+    # traceparent / tracestate が指定されている場合は、トレースを繋げるためにそのまま渡す
+    # 補完（type: "complete"）の場合は、カーソル位置もそのまま渡す
+    # メッセージの言語は、クライアントが指定した locale、ブラウザの Accept-Language の順に使用される
     command_json = {
+      type: command_data["type"],
       command: command_data["command"] || command,
-      session_id: command_data["session_id"]
-    }.to_json
+      cursor: command_data["cursor"],
+      session_id: command_data["session_id"],
+      request_id: request_id,
+      traceparent: command_data["traceparent"],
+      tracestate: command_data["tracestate"],
+      locale: command_data["locale"],
+      accept_language: accept_language
+    }.compact.to_json
 
     # 結果を待機するためのキューを作成
     result_queue = Queue.new
@@ -69,8 +87,18 @@ class CommandExecutorService
               parsed_result = JSON.parse(message)
               Rails.logger.info "結果を受信: #{message}"
 
-              # セッションIDが一致する結果のみを処理
-              if command_data["session_id"].nil? || parsed_result["session_id"] == command_data["session_id"]
+              # セッションへの通知（シャットダウン・セッションの終了・管理APIからのお知らせ）は
+              # 返信とは別にクライアントへ転送し、返信を待ち続ける
+              if parsed_result["status"] == "notice"
+                if on_notice && parsed_result["session_id"].present? && parsed_result["session_id"] == command_data["session_id"]
+                  on_notice.call(parsed_result)
+                end
+                next
+              end
+
+              # リクエストIDが一致する結果のみを返信として処理
+              # （通知や、同じセッションの別のリクエストの結果を返信として扱わない）
+              if parsed_result["request_id"] == request_id
                 result_queue.push(parsed_result)
                 subscription_active = false
                 redis.unsubscribe
@@ -78,7 +106,7 @@ class CommandExecutorService
             rescue JSON::ParserError => e
               Rails.logger.error "JSONパースエラー: #{e.message}, メッセージ: #{message}"
               if subscription_active
-                result_queue.push({ status: "error", command: command, error: "結果のパースに失敗: #{e.message}" })
+                result_queue.push({ status: "error", command: command, error: "結果のパースに失敗: #{e.message}", error_code: "PROTOCOL_ERROR" })
                 subscription_active = false
                 redis.unsubscribe
               end
@@ -98,7 +126,7 @@ class CommandExecutorService
         end
       rescue => e
         Rails.logger.error "Redis購読エラー: #{e.message}"
-        result_queue.push({ status: "error", command: command, error: "Redis購読エラー: #{e.message}" })
+        result_queue.push({ status: "error", command: command, error: "Redis購読エラー: #{e.message}", error_code: "INTERNAL_ERROR" })
       ensure
         subscription_active = false
       end
@@ -119,7 +147,7 @@ class CommandExecutorService
 
     if result.nil?
       Rails.logger.error "コマンド実行タイムアウト（#{elapsed_time}秒経過）"
-      { status: "error", command: command, error: "コマンド実行タイムアウト（#{elapsed_time}秒経過）" }
+      { status: "error", command: command, error: "コマンド実行タイムアウト（#{elapsed_time}秒経過）", error_code: "TIMEOUT" }
     else
       Rails.logger.info "コマンド実行完了: #{result.inspect}"
       result
@@ -0,0 +1,5 @@
+module profile
+
+go 1.23.1
+
+require gopkg.in/yaml.v3 v3.0.1
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// デフォルトの言語
+const defaultLocale = "ja"
+
+// messages は、言語ごとのメッセージ（メッセージIDをキーとする）
+var messages = map[string]map[string]string{
+	"ja": {
+		"usage":          "使い方: profile [--about] [--skills] [--works] [--career] [--contact] [--json]",
+		"usage.all":      "セクションを指定しない場合は、すべてのセクションを表示します",
+		"usage.options":  "オプション:",
+		"flag.about":     "自己紹介を表示します",
+		"flag.skills":    "スキルを表示します",
+		"flag.works":     "制作物を表示します",
+		"flag.career":    "経歴を表示します",
+		"flag.contact":   "連絡先を表示します",
+		"flag.json":      "JSON形式で出力します",
+		"flag.no-color":  "色を付けずに出力します",
+		"flag.width":     "折り返す幅（省略時は COLUMNS 環境変数、未設定の場合は80）",
+		"flag.data":      "プロフィールのデータファイル（YAMLまたはJSON）",
+		"flag.lang":      "表示する言語（ja / en、省略時は TERMINAL_LOCALE・LANG 環境変数）",
+		"error.argument": "不明な引数です: %s",
+		"error.read":     "プロフィールの読み込みエラー: %v",
+		"error.parse":    "プロフィールのパースエラー: %v",
+		"error.no_name":  "プロフィールに name がありません: %s",
+		"section.empty":  "（未登録）",
+		"error.locale":   "不明な言語です: %s",
+	},
+	"en": {
+		"usage":          "Usage: profile [--about] [--skills] [--works] [--career] [--contact] [--json]",
+		"usage.all":      "Shows every section when no section is given",
+		"usage.options":  "Options:",
+		"flag.about":     "Show the introduction",
+		"flag.skills":    "Show skills",
+		"flag.works":     "Show works",
+		"flag.career":    "Show career",
+		"flag.contact":   "Show contact information",
+		"flag.json":      "Output as JSON",
+		"flag.no-color":  "Output without colors",
+		"flag.width":     "Wrap width (defaults to the COLUMNS environment variable, or 80 if unset)",
+		"flag.data":      "Profile data file (YAML or JSON)",
+		"flag.lang":      "Display language (ja / en, defaults to the TERMINAL_LOCALE or LANG environment variable)",
+		"error.argument": "unknown argument: %s",
+		"error.read":     "failed to read the profile: %v",
+		"error.parse":    "failed to parse the profile: %v",
+		"error.no_name":  "the profile has no name: %s",
+		"section.empty":  "(not registered)",
+		"error.locale":   "unknown language: %s",
+	},
+}
+
+// msg はメッセージIDに対応する言語のメッセージを返す
+// 翻訳がない場合はデフォルトの言語のメッセージを返す
+func msg(locale, id string, args ...any) string {
+	format, ok := messages[locale][id]
+	if !ok {
+		format = messages[defaultLocale][id]
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// detectLocale は環境変数から表示する言語を求める
+// TERMINAL_LOCALE（terminalサーバーがリクエストの言語を設定する）、LC_ALL、LANG の順に使用する
+func detectLocale() string {
+	for _, key := range []string{"TERMINAL_LOCALE", "LC_ALL", "LANG"} {
+		if locale := normalizeLocale(os.Getenv(key)); locale != "" {
+			return locale
+		}
+	}
+	return defaultLocale
+}
+
+// normalizeLocale は "en_US.UTF-8" などの言語の指定から、対応している言語名を返す
+// 対応していない場合は空文字列を返す
+func normalizeLocale(s string) string {
+	lang := strings.ToLower(s)
+	if i := strings.IndexAny(lang, "_-."); i >= 0 {
+		lang = lang[:i]
+	}
+	if _, ok := messages[lang]; ok {
+		return lang
+	}
+	return ""
+}
@@ -1,9 +1,178 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 )
 
+// プロフィールのデータファイルのデフォルトの配置場所
+// PROFILE_DATA 環境変数または -data フラグで変更できる
+const defaultDataPath = "/usr/share/profile/profile.yaml"
+
+// 端末の幅が分からない場合に使用する幅
+const defaultWidth = 80
+
+// sections は、表示するセクションの名前と書き込む関数（表示順）
+// フラグの説明はメッセージID "flag.<name>" で参照する
+var sections = []struct {
+	name   string
+	render func(*renderer, *Profile)
+}{
+	{"about", (*renderer).about},
+	{"skills", (*renderer).skills},
+	{"works", (*renderer).works},
+	{"career", (*renderer).career},
+	{"contact", (*renderer).contact},
+}
+
 func main() {
-    fmt.Println("コマンドが不正です。`-help` フラグを使用して使い方を確認してください。")
+	os.Exit(run(os.Args[1:]))
+}
+
+// run はコマンドを実行し、終了コードを返す
+func run(args []string) int {
+	// フラグの説明を表示する言語で作成するため、パースの前に --lang を読み取る
+	locale := detectLocale()
+	if lang, ok := langArg(args); ok {
+		locale = normalizeLocale(lang)
+		if locale == "" {
+			fmt.Fprintf(os.Stderr, "profile: %s\n", msg(defaultLocale, "error.locale", lang))
+			return 2
+		}
+	}
+
+	fs := flag.NewFlagSet("profile", flag.ContinueOnError)
+	selected := make([]*bool, len(sections))
+	for i, s := range sections {
+		selected[i] = fs.Bool(s.name, false, msg(locale, "flag."+s.name))
+	}
+	asJSON := fs.Bool("json", false, msg(locale, "flag.json"))
+	noColor := fs.Bool("no-color", false, msg(locale, "flag.no-color"))
+	width := fs.Int("width", 0, msg(locale, "flag.width"))
+	dataPath := fs.String("data", envOr("PROFILE_DATA", defaultDataPath), msg(locale, "flag.data"))
+	fs.String("lang", locale, msg(locale, "flag.lang"))
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), msg(locale, "usage"))
+		fmt.Fprintln(fs.Output(), msg(locale, "usage.all"))
+		fmt.Fprintln(fs.Output(), "\n"+msg(locale, "usage.options"))
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "profile: %s\n", msg(locale, "error.argument", fs.Arg(0)))
+		fs.Usage()
+		return 2
+	}
+
+	p, err := loadProfile(*dataPath, locale)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "profile: %v\n", err)
+		return 1
+	}
+
+	// セクションを指定しない場合はすべて表示する
+	all := true
+	for _, s := range selected {
+		if *s {
+			all = false
+		}
+	}
+
+	if *asJSON {
+		return printJSON(p, selected, all)
+	}
+
+	r := &renderer{
+		width:  terminalWidth(*width),
+		color:  !*noColor && os.Getenv("NO_COLOR") == "",
+		locale: locale,
+	}
+	r.header(p)
+	for i, s := range sections {
+		if all || *selected[i] {
+			s.render(r, p)
+		}
+	}
+	fmt.Print(r.b.String())
+	return 0
+}
+
+// printJSON は選択したセクションをJSON形式で出力する
+func printJSON(p *Profile, selected []*bool, all bool) int {
+	out := Profile{Name: p.Name, Title: p.Title}
+	for i, s := range sections {
+		if !all && !*selected[i] {
+			continue
+		}
+		switch s.name {
+		case "about":
+			out.About = p.About
+		case "skills":
+			out.Skills = p.Skills
+		case "works":
+			out.Works = p.Works
+		case "career":
+			out.Career = p.Career
+		case "contact":
+			out.Contact = p.Contact
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		fmt.Fprintf(os.Stderr, "profile: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// terminalWidth は折り返す幅を返す
+// フラグ、COLUMNS 環境変数、デフォルト値の順に使用する
+func terminalWidth(flagWidth int) int {
+	if flagWidth > 0 {
+		return flagWidth
+	}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return defaultWidth
+}
+
+// langArg は引数から --lang（-lang）の値を取り出す
+// flagパッケージと同じく、"--lang en" と "--lang=en" の両方の形式に対応する
+func langArg(args []string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "lang" {
+			continue
+		}
+		if hasValue {
+			return value, true
+		}
+		if i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// envOr は環境変数が設定されていればその値を、なければデフォルト値を返す
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile は、サイトの管理者のプロフィールを表す構造体
+// プロフィールのデータファイル（YAMLまたはJSON）から読み込む
+type Profile struct {
+	Name    string        `yaml:"name" json:"name"`                 // 名前
+	Title   string        `yaml:"title" json:"title,omitempty"`     // 肩書き
+	About   string        `yaml:"about" json:"about,omitempty"`     // 自己紹介
+	Skills  []SkillGroup  `yaml:"skills" json:"skills,omitempty"`   // スキル
+	Works   []Work        `yaml:"works" json:"works,omitempty"`     // 制作物
+	Career  []CareerEntry `yaml:"career" json:"career,omitempty"`   // 経歴
+	Contact []ContactLink `yaml:"contact" json:"contact,omitempty"` // 連絡先
+}
+
+// SkillGroup は、分類ごとのスキルの一覧
+type SkillGroup struct {
+	Category string   `yaml:"category" json:"category"` // 分類（例: 言語）
+	Items    []string `yaml:"items" json:"items"`       // スキル
+}
+
+// Work は、制作物1件を表す構造体
+type Work struct {
+	Name        string   `yaml:"name" json:"name"`                         // 名前
+	Description string   `yaml:"description" json:"description,omitempty"` // 説明
+	URL         string   `yaml:"url" json:"url,omitempty"`                 // URL
+	Tech        []string `yaml:"tech" json:"tech,omitempty"`               // 使用した技術
+}
+
+// CareerEntry は、経歴1件を表す構造体
+type CareerEntry struct {
+	Period      string `yaml:"period" json:"period"`                     // 期間（例: 2023 - 現在）
+	Title       string `yaml:"title" json:"title"`                       // 所属・役割
+	Description string `yaml:"description" json:"description,omitempty"` // 説明
+}
+
+// ContactLink は、連絡先1件を表す構造体
+type ContactLink struct {
+	Label string `yaml:"label" json:"label"` // 種類（例: GitHub）
+	Value string `yaml:"value" json:"value"` // アドレス・URL
+}
+
+// loadProfile はプロフィールのデータファイルを読み込む
+// 拡張子が.jsonの場合はJSON、それ以外はYAMLとしてパースする
+// 同じディレクトリに言語ごとのデータファイル（例: profile.en.yaml）がある場合はそちらを使用する
+func loadProfile(path, locale string) (*Profile, error) {
+	path = localizedPath(path, locale)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.New(msg(locale, "error.read", err))
+	}
+
+	var p Profile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &p)
+	default:
+		err = yaml.Unmarshal(data, &p)
+	}
+	if err != nil {
+		return nil, errors.New(msg(locale, "error.parse", err))
+	}
+	if p.Name == "" {
+		return nil, errors.New(msg(locale, "error.no_name", path))
+	}
+	return &p, nil
+}
+
+// localizedPath は言語ごとのデータファイル（例: profile.yaml に対する profile.en.yaml）のパスを返す
+// 存在しない場合は元のパスを返す
+func localizedPath(path, locale string) string {
+	ext := filepath.Ext(path)
+	localized := strings.TrimSuffix(path, ext) + "." + locale + ext
+	if _, err := os.Stat(localized); err == nil {
+		return localized
+	}
+	return path
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ANSIエスケープシーケンス
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiCyan   = "\x1b[36m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+)
+
+// 本文を字下げする幅
+const indent = "  "
+
+// renderer は、プロフィールを端末の幅に合わせて整形する構造体
+type renderer struct {
+	b      strings.Builder
+	width  int    // 端末の幅（桁数）
+	color  bool   // ANSIエスケープシーケンスで色を付けるかどうか
+	locale string // 表示する言語
+}
+
+// style は色が有効な場合のみ、文字列をエスケープシーケンスで囲む
+func (r *renderer) style(s string, codes ...string) string {
+	if !r.color || len(codes) == 0 {
+		return s
+	}
+	return strings.Join(codes, "") + s + ansiReset
+}
+
+// header はプロフィールの名前と肩書きを書き込む
+func (r *renderer) header(p *Profile) {
+	r.b.WriteString(r.style(p.Name, ansiBold, ansiCyan))
+	if p.Title != "" {
+		r.b.WriteString("  " + r.style(p.Title, ansiDim))
+	}
+	r.b.WriteString("\n")
+	r.b.WriteString(r.style(strings.Repeat("─", min(r.width, 40)), ansiDim) + "\n")
+}
+
+// section はセクションの見出しを書き込む
+func (r *renderer) section(title string) {
+	r.b.WriteString("\n" + r.style("■ "+title, ansiBold, ansiGreen) + "\n")
+}
+
+// paragraph は文章を字下げし、端末の幅で折り返して書き込む
+func (r *renderer) paragraph(text, prefix string) {
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		for _, wrapped := range wrap(line, r.width-displayWidth(prefix)) {
+			r.b.WriteString(prefix + wrapped + "\n")
+		}
+	}
+}
+
+// about は自己紹介のセクションを書き込む
+func (r *renderer) about(p *Profile) {
+	r.section("About")
+	if p.About == "" {
+		r.empty()
+		return
+	}
+	r.paragraph(p.About, indent)
+}
+
+// skills はスキルのセクションを書き込む
+func (r *renderer) skills(p *Profile) {
+	r.section("Skills")
+	if len(p.Skills) == 0 {
+		r.empty()
+		return
+	}
+	width := 0
+	for _, g := range p.Skills {
+		width = max(width, displayWidth(g.Category))
+	}
+	for _, g := range p.Skills {
+		label := g.Category + strings.Repeat(" ", width-displayWidth(g.Category))
+		lines := wrap(strings.Join(g.Items, ", "), r.width-len(indent)-width-2)
+		for i, line := range lines {
+			if i == 0 {
+				r.b.WriteString(indent + r.style(label, ansiYellow) + "  " + line + "\n")
+			} else {
+				r.b.WriteString(indent + strings.Repeat(" ", width+2) + line + "\n")
+			}
+		}
+	}
+}
+
+// works は制作物のセクションを書き込む
+func (r *renderer) works(p *Profile) {
+	r.section("Works")
+	if len(p.Works) == 0 {
+		r.empty()
+		return
+	}
+	for i, w := range p.Works {
+		if i > 0 {
+			r.b.WriteString("\n")
+		}
+		r.b.WriteString(indent + r.style(w.Name, ansiBold, ansiYellow) + "\n")
+		if w.Description != "" {
+			r.paragraph(w.Description, indent+indent)
+		}
+		if len(w.Tech) > 0 {
+			r.paragraph(r.style(strings.Join(w.Tech, " / "), ansiDim), indent+indent)
+		}
+		if w.URL != "" {
+			r.b.WriteString(indent + indent + r.style(w.URL, ansiCyan) + "\n")
+		}
+	}
+}
+
+// career は経歴のセクションを書き込む
+func (r *renderer) career(p *Profile) {
+	r.section("Career")
+	if len(p.Career) == 0 {
+		r.empty()
+		return
+	}
+	for _, c := range p.Career {
+		r.b.WriteString(indent + r.style(c.Period, ansiYellow) + "  " + r.style(c.Title, ansiBold) + "\n")
+		if c.Description != "" {
+			r.paragraph(c.Description, indent+indent)
+		}
+	}
+}
+
+// contact は連絡先のセクションを書き込む
+func (r *renderer) contact(p *Profile) {
+	r.section("Contact")
+	if len(p.Contact) == 0 {
+		r.empty()
+		return
+	}
+	width := 0
+	for _, c := range p.Contact {
+		width = max(width, displayWidth(c.Label))
+	}
+	for _, c := range p.Contact {
+		label := c.Label + strings.Repeat(" ", width-displayWidth(c.Label))
+		r.b.WriteString(fmt.Sprintf("%s%s  %s\n", indent, r.style(label, ansiYellow), r.style(c.Value, ansiCyan)))
+	}
+}
+
+// empty は内容が登録されていないセクションの本文を書き込む
+func (r *renderer) empty() {
+	r.b.WriteString(indent + r.style(msg(r.locale, "section.empty"), ansiDim) + "\n")
+}
+
+// wrap は文字列を指定した表示幅で折り返す
+// 英単語は空白の位置で、日本語などの全角文字は任意の位置で折り返す
+func wrap(text string, width int) []string {
+	if width < 10 {
+		width = 10
+	}
+
+	var lines []string
+	var line strings.Builder
+	lineWidth := 0
+	flush := func() {
+		lines = append(lines, strings.TrimRight(line.String(), " "))
+		line.Reset()
+		lineWidth = 0
+	}
+
+	for _, token := range tokenize(text) {
+		w := displayWidth(token)
+		if lineWidth > 0 && lineWidth+w > width {
+			flush()
+			if token == " " {
+				continue
+			}
+		}
+		// 1単語が幅を超える場合は文字単位で分割する
+		for w > width {
+			head, headWidth := cutWidth(token, width-lineWidth)
+			line.WriteString(head)
+			flush()
+			token, w = token[len(head):], w-headWidth
+		}
+		line.WriteString(token)
+		lineWidth += w
+	}
+	if line.Len() > 0 || len(lines) == 0 {
+		flush()
+	}
+	return lines
+}
+
+// tokenize は文字列を、折り返しの単位（英単語・空白・全角文字1文字・エスケープシーケンス付きの文字列）に分割する
+func tokenize(text string) []string {
+	var tokens []string
+	var word strings.Builder
+	inEscape := false
+	for _, c := range text {
+		switch {
+		case c == '\x1b':
+			inEscape = true
+			word.WriteRune(c)
+		case inEscape:
+			word.WriteRune(c)
+			if c == 'm' {
+				inEscape = false
+			}
+		case c == ' ' || c == '\t':
+			if word.Len() > 0 {
+				tokens = append(tokens, word.String())
+				word.Reset()
+			}
+			tokens = append(tokens, " ")
+		case runeWidth(c) == 2:
+			if word.Len() > 0 {
+				tokens = append(tokens, word.String())
+				word.Reset()
+			}
+			tokens = append(tokens, string(c))
+		default:
+			word.WriteRune(c)
+		}
+	}
+	if word.Len() > 0 {
+		tokens = append(tokens, word.String())
+	}
+	return tokens
+}
+
+// cutWidth は文字列の先頭から、指定した表示幅に収まる部分とその幅を返す
+func cutWidth(s string, width int) (string, int) {
+	w := 0
+	for i, c := range s {
+		if w+runeWidth(c) > width && i > 0 {
+			return s[:i], w
+		}
+		w += runeWidth(c)
+	}
+	return s, w
+}
+
+// displayWidth は文字列を端末に表示したときの幅を返す
+// エスケープシーケンスは幅に含めない
+func displayWidth(s string) int {
+	w := 0
+	inEscape := false
+	for _, c := range s {
+		switch {
+		case c == '\x1b':
+			inEscape = true
+		case inEscape:
+			if c == 'm' {
+				inEscape = false
+			}
+		default:
+			w += runeWidth(c)
+		}
+	}
+	return w
+}
+
+// runeWidth は1文字を端末に表示したときの幅を返す
+// 日本語などの全角文字は2、それ以外は1とする
+func runeWidth(c rune) int {
+	switch {
+	case unicode.In(c, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+		return 2
+	case c >= 0x3000 && c <= 0x303f, // 全角の句読点・括弧
+		c >= 0xff01 && c <= 0xff60, // 全角英数字・記号
+		c >= 0xffe0 && c <= 0xffe6:
+		return 2
+	default:
+		return 1
+	}
+}
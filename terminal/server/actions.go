@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// ActionType は、コマンドがフロントエンドに実行させる操作の種類
+type ActionType string
+
+const (
+	ActionClear     ActionType = "clear"      // 画面（スクロールバックを含む）を消去する
+	ActionOpenURL   ActionType = "open_url"   // URLを新しいタブで開く
+	ActionShowImage ActionType = "show_image" // 画像を表示する
+)
+
+// Action は、コマンドがフロントエンドに実行させる操作
+// 出力（テキスト）とは別に結果の actions に含め、対応していないクライアントは無視できる
+type Action struct {
+	Type ActionType `json:"type"`          // 操作の種類
+	URL  string     `json:"url,omitempty"` // 開くURL（open_url）・画像のURLまたはdata URL（show_image）
+	Alt  string     `json:"alt,omitempty"` // 画像の代替テキスト（show_image、ファイル名）
+}
+
+// 表示できる画像の形式（拡張子とMIMEタイプ）
+// スクリプトを含められるSVGは対象外とする
+var imageTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// openで開けるリンク（名前をキーとするURL）
+//
+//go:embed links.json
+var linksJSON []byte
+
+// 名前で開けるリンク
+var links = loadLinks()
+
+// loadLinks は組み込みのリンクの定義を読み込む
+func loadLinks() map[string]string {
+	var links map[string]string
+	if err := json.Unmarshal(linksJSON, &links); err != nil {
+		panic(fmt.Sprintf("links.jsonのパースエラー: %v", err))
+	}
+	return links
+}
+
+// actionsKey は、コンテキストにコマンドが発行した操作の記録先を格納するためのキー
+type actionsKey struct{}
+
+// actionRecorder は、コマンドの実行中に発行された操作を記録する
+type actionRecorder struct {
+	actions []Action // 発行された順の操作
+}
+
+// withActions は操作の記録先を格納したコンテキストを返す
+func withActions(ctx context.Context) (context.Context, *actionRecorder) {
+	recorder := &actionRecorder{}
+	return context.WithValue(ctx, actionsKey{}, recorder), recorder
+}
+
+// emitAction はフロントエンドに実行させる操作を、コマンドの結果に追加する
+// 許可リストで検証し、許可されていない操作の場合はエラーを返す
+// 操作を記録しないコンテキスト（補完など）では何もしない
+func emitAction(ctx context.Context, action Action) error {
+	if err := validateAction(action); err != nil {
+		return err
+	}
+	if recorder, ok := ctx.Value(actionsKey{}).(*actionRecorder); ok {
+		recorder.actions = append(recorder.actions, action)
+	}
+	return nil
+}
+
+// validateAction は操作が許可されているかどうかを検証する
+// URLは action-origins に含まれるオリジンのもののみ、画像はそれに加えて表示できる形式のdata URLを許可する
+func validateAction(action Action) error {
+	denied := newMessageError("action.denied", param("type", string(action.Type)), param("url", action.URL))
+	switch action.Type {
+	case ActionClear:
+		if action.URL != "" {
+			return denied
+		}
+	case ActionOpenURL:
+		if !allowedActionURL(action.URL) {
+			return denied
+		}
+	case ActionShowImage:
+		if strings.HasPrefix(action.URL, "data:") {
+			return validateImageData(action.URL)
+		}
+		if !allowedActionURL(action.URL) {
+			return denied
+		}
+	default:
+		return denied
+	}
+	return nil
+}
+
+// allowedActionURL はURLのオリジンが action-origins に含まれるかどうかを返す
+// ユーザー情報（user:pass@）を含むURLは許可しない
+func allowedActionURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User != nil || u.Host == "" {
+		return false
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return false
+	}
+	origin := u.Scheme + "://" + strings.ToLower(u.Host)
+	for _, allowed := range cfg.ActionOrigins {
+		if origin == strings.ToLower(strings.TrimSuffix(allowed, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateImageData は画像のdata URL（data:image/png;base64,...）の形式とサイズを検証する
+func validateImageData(dataURL string) error {
+	header, data, ok := strings.Cut(strings.TrimPrefix(dataURL, "data:"), ",")
+	mimeType, ok2 := strings.CutSuffix(header, ";base64")
+	allowed := false
+	for _, t := range imageTypes {
+		allowed = allowed || mimeType == t
+	}
+	if !ok || !ok2 || !allowed {
+		return newMessageError("action.denied", param("type", string(ActionShowImage)), param("url", "data:"+header))
+	}
+	image, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return newMessageError("action.denied", param("type", string(ActionShowImage)), param("url", "data:"+header))
+	}
+	if len(image) > cfg.ImageMaxSize {
+		return newMessageError("action.image_too_large", param("limit", cfg.ImageMaxSize))
+	}
+	return nil
+}
+
+// imageType は表示できる画像のファイルの場合、そのMIMEタイプを返す
+// 拡張子と内容（先頭のバイト列）の形式が一致する場合のみ画像とみなす
+func imageType(name string, data []byte) (string, bool) {
+	mimeType, ok := imageTypes[strings.ToLower(path.Ext(name))]
+	if !ok || http.DetectContentType(data) != mimeType {
+		return "", false
+	}
+	return mimeType, true
+}
+
+// imageDataURL は画像のデータをdata URLに変換する
+func imageDataURL(mimeType string, data []byte) string {
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// hyperlink はtextに、OSC 8のハイパーリンク（対応している端末ではクリックでURLを開く）を付ける
+// http・https以外のURLや、制御文字（C0・DEL・C1）・不正なUTF-8を含むURLはリンクにしない
+// （C1のST（U+009C）などでシーケンスを終端し、後続の文字列を端末に解釈させないようにする）
+func hyperlink(rawURL, text string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || !utf8.ValidString(rawURL) {
+		return text
+	}
+	for _, c := range rawURL {
+		if c < 0x20 || (c >= 0x7f && c <= 0x9f) {
+			return text
+		}
+	}
+	return "\x1b]8;;" + rawURL + "\x1b\\" + text + "\x1b]8;;\x1b\\"
+}
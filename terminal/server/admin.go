@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// maintenanceState は、メンテナンスモードの状態を表す構造体
+// メンテナンス中は新しいコマンドを受け付けずにメッセージを返す
+type maintenanceState struct {
+	mu      sync.RWMutex
+	enabled bool   // メンテナンス中かどうか
+	message string // コマンドを拒否する際に返すメッセージ（空の場合は言語に応じたデフォルトのメッセージ）
+}
+
+// グローバルなメンテナンスモードの状態
+var maintenance = &maintenanceState{}
+
+// Get はメンテナンス中かどうかと、拒否する際のメッセージを返す
+func (m *maintenanceState) Get() (bool, string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.enabled, m.message
+}
+
+// Set はメンテナンスモードを切り替える
+// メッセージが空の場合は、コマンドを拒否する際に言語に応じたデフォルトのメッセージを使用する
+func (m *maintenanceState) Set(enabled bool, message string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enabled = enabled
+	m.message = message
+}
+
+// adminAPI は、セッションを管理するHTTP APIのハンドラー
+// すべての操作はSessionManagerを通じて行う
+type adminAPI struct {
+	sessions  *SessionManager // 操作対象のセッションマネージャー
+	transport Transport       // セッションへの通知に使用するトランスポート
+}
+
+// maintenanceRequest は、メンテナンスモードの取得・変更のリクエスト・レスポンス
+type maintenanceRequest struct {
+	Enabled bool   `json:"enabled"`           // メンテナンス中かどうか
+	Message string `json:"message,omitempty"` // コマンドを拒否する際に返すメッセージ
+}
+
+// broadcastRequest は、全セッションへの通知のリクエスト
+type broadcastRequest struct {
+	Message string `json:"message"` // 通知するメッセージ
+}
+
+// newAdminHandler は管理APIのハンドラーを作成する
+// すべてのエンドポイントで認証トークン（Authorization: Bearer）を要求する
+func newAdminHandler(sessions *SessionManager, transport Transport, token string) http.Handler {
+	a := &adminAPI{sessions: sessions, transport: transport}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/sessions", a.listSessions)
+	mux.HandleFunc("GET /admin/sessions/{id}", a.getSession)
+	mux.HandleFunc("DELETE /admin/sessions/{id}", a.killSession)
+	mux.HandleFunc("POST /admin/broadcast", a.broadcast)
+	mux.HandleFunc("GET /admin/recordings", a.listRecordings)
+	mux.HandleFunc("GET /admin/recordings/{name}", a.getRecording)
+	mux.HandleFunc("GET /admin/maintenance", a.getMaintenance)
+	mux.HandleFunc("PUT /admin/maintenance", a.setMaintenance)
+	return requireToken(token, mux)
+}
+
+// requireToken は認証トークンが一致しないリクエストを拒否する
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			slog.Warn("管理APIの認証に失敗", "remote_addr", r.RemoteAddr, "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="terminal-admin"`)
+			writeAdminError(w, http.StatusUnauthorized, errors.New("認証に失敗しました"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listSessions はセッションの一覧を返す
+func (a *adminAPI) listSessions(w http.ResponseWriter, r *http.Request) {
+	sessions := a.sessions.Sessions()
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, session.Info(false))
+	}
+	writeAdminJSON(w, http.StatusOK, infos)
+}
+
+// getSession はセッションの情報と直近のコマンド履歴を返す
+func (a *adminAPI) getSession(w http.ResponseWriter, r *http.Request) {
+	session, exists := a.sessions.Lookup(r.PathValue("id"))
+	if !exists {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("セッションが存在しません: %s", r.PathValue("id")))
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, session.Info(true))
+}
+
+// killSession はセッションを強制的に終了し、クライアントに通知する
+func (a *adminAPI) killSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("id")
+	session, exists := a.sessions.Lookup(sessionID)
+	if !exists {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("セッションが存在しません: %s", sessionID))
+		return
+	}
+
+	locale := session.Locale()
+	if locale == "" {
+		locale = cfg.Locale
+	}
+	slog.Info("管理APIからセッションを終了", "session_id", sessionID, "remote_addr", r.RemoteAddr)
+	if err := a.sessions.Kill(sessionID); err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// 終了したセッションは言語を参照できなくなるため、終了前に取得した言語で通知する
+	a.notify(r.Context(), sessionID, localizeError(locale, errSessionKilled))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// broadcast は全セッションに通知を送信する
+func (a *adminAPI) broadcast(w http.ResponseWriter, r *http.Request) {
+	var req broadcastRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("リクエストのパースに失敗しました: %w", err))
+		return
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		writeAdminError(w, http.StatusBadRequest, errors.New("message を指定してください"))
+		return
+	}
+
+	sessionIDs := a.sessions.SessionIDs()
+	slog.Info("管理APIから通知を送信", "sessions", len(sessionIDs), "remote_addr", r.RemoteAddr)
+	sent := 0
+	for _, sessionID := range sessionIDs {
+		if a.notify(r.Context(), sessionID, req.Message) {
+			sent++
+		}
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]int{"sessions": len(sessionIDs), "sent": sent})
+}
+
+// listRecordings は録画を終えたファイルの一覧を返す
+func (a *adminAPI) listRecordings(w http.ResponseWriter, r *http.Request) {
+	recordings, err := listRecordings(cfg.RecordDir)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, recordings)
+}
+
+// getRecording は録画を終えたファイルをasciicast v2形式で返す
+func (a *adminAPI) getRecording(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	path, ok := recordingPath(cfg.RecordDir, name)
+	if !ok {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("不正なファイル名です: %s", name))
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("録画が存在しません: %s", name))
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	slog.Info("管理APIから録画を取得", "name", name, "remote_addr", r.RemoteAddr)
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// getMaintenance はメンテナンスモードの状態を返す
+func (a *adminAPI) getMaintenance(w http.ResponseWriter, r *http.Request) {
+	enabled, message := maintenance.Get()
+	writeAdminJSON(w, http.StatusOK, maintenanceRequest{Enabled: enabled, Message: message})
+}
+
+// setMaintenance はメンテナンスモードを切り替える
+func (a *adminAPI) setMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req maintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("リクエストのパースに失敗しました: %w", err))
+		return
+	}
+
+	maintenance.Set(req.Enabled, req.Message)
+	enabled, message := maintenance.Get()
+	slog.Info("メンテナンスモードを変更", "enabled", enabled, "remote_addr", r.RemoteAddr)
+	writeAdminJSON(w, http.StatusOK, maintenanceRequest{Enabled: enabled, Message: message})
+}
+
+// notify はセッションに通知を送信し、送信できたかどうかを返す
+func (a *adminAPI) notify(ctx context.Context, sessionID, message string) bool {
+	notice := CommandResult{
+		Status:    "notice",
+		Result:    message,
+		SessionID: sessionID,
+	}
+	if err := a.transport.Publish(ctx, &notice); err != nil {
+		slog.Warn("通知の送信エラー", "error", err, "session_id", sessionID)
+		return false
+	}
+	return true
+}
+
+// writeAdminJSON はレスポンスをJSONで書き込む
+func writeAdminJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("管理APIのレスポンス書き込みエラー", "error", err)
+	}
+}
+
+// writeAdminError はエラーをJSONで書き込む
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	writeAdminJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// backoff は、再試行の待機時間を指数的に増加させる構造体
+// 複数のクライアントが同時に再試行しないよう、待機時間にジッターを加える
+type backoff struct {
+	initial time.Duration // 待機時間の初期値
+	max     time.Duration // 待機時間の上限
+	current time.Duration // 次回の待機時間
+}
+
+// newBackoff は新しいbackoffを作成
+func newBackoff(initial, max time.Duration) *backoff {
+	return &backoff{
+		initial: initial,
+		max:     max,
+		current: initial,
+	}
+}
+
+// Next は次の待機時間を返し、その次の待機時間を2倍にする
+func (b *backoff) Next() time.Duration {
+	wait := b.current
+	b.current *= 2
+	if b.current > b.max {
+		b.current = b.max
+	}
+	// 待機時間の±20%のジッターを加える
+	jitter := time.Duration(rand.Int64N(int64(wait)/5*2+1)) - wait/5
+	return wait + jitter
+}
+
+// Reset は待機時間を初期値に戻す
+func (b *backoff) Reset() {
+	b.current = b.initial
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(time.Second, 5*time.Second)
+	// ジッターは待機時間の±20%
+	within := func(got, want time.Duration) bool {
+		return got >= want-want/5 && got <= want+want/5
+	}
+	for i, want := range []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if got := b.Next(); !within(got, want) {
+			t.Errorf("Next() #%d = %v, want %v ±20%%", i+1, got, want)
+		}
+	}
+	b.Reset()
+	if got := b.Next(); !within(got, time.Second) {
+		t.Errorf("Next() after Reset = %v, want 1s ±20%%", got)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// completionKind は、ビルトインコマンドの引数の補完方法
+type completionKind int
+
+const (
+	completeNone      completionKind = iota // 補完しない
+	completePaths                           // ファイル・ディレクトリのパス
+	completeDirs                            // ディレクトリのパスのみ
+	completeVariables                       // セッションの環境変数名
+	completeAliases                         // セッションのエイリアス名
+	completeCommands                        // 実行できるコマンド名（ビルトインコマンドを含む）
+)
+
+// Builtin は、Goで実装するコマンドのインターフェース
+// bashを起動せずに実行し、セッションの状態を直接参照・変更できる
+type Builtin interface {
+	// Name はコマンド名を返す
+	Name() string
+	// Usage は使い方（例: "cd [ディレクトリ]"）を返す
+	Usage() string
+	// Help はコマンドの説明を返す
+	Help() string
+	// Completion は引数の補完方法を返す
+	Completion() completionKind
+	// Run はコマンドを実行し、出力を返す
+	// argsにはコマンド名を除いた引数を指定する。セッションのロックを保持した状態で呼び出される
+	Run(ctx context.Context, session *Session, args []string) (string, error)
+}
+
+// builtinAvailability は、設定によって使用できるかどうかが変わるビルトインコマンドが実装するインターフェース
+// 使用できない場合は、登録されていないものとして扱う
+type builtinAvailability interface {
+	// Available は現在の設定でコマンドを使用できるかどうかを返す
+	Available() bool
+}
+
+// available はビルトインコマンドを現在の設定で使用できるかどうかを返す
+func available(b Builtin) bool {
+	a, ok := b.(builtinAvailability)
+	return !ok || a.Available()
+}
+
+// BuiltinRegistry は、ビルトインコマンドを名前で管理する構造体
+type BuiltinRegistry struct {
+	builtins map[string]Builtin // コマンド名をキーとするビルトインコマンド
+}
+
+// グローバルなビルトインコマンドの登録先
+// 各ビルトインコマンドはinitで登録する
+var builtins = NewBuiltinRegistry()
+
+// NewBuiltinRegistry は新しいBuiltinRegistryを作成
+func NewBuiltinRegistry() *BuiltinRegistry {
+	return &BuiltinRegistry{builtins: make(map[string]Builtin)}
+}
+
+// Register はビルトインコマンドを登録する
+// 同じ名前のコマンドを二重に登録した場合はpanicする
+func (r *BuiltinRegistry) Register(b Builtin) {
+	if _, exists := r.builtins[b.Name()]; exists {
+		panic(fmt.Sprintf("ビルトインコマンドが二重に登録されています: %s", b.Name()))
+	}
+	r.builtins[b.Name()] = b
+}
+
+// Lookup は名前に対応するビルトインコマンドを返す
+func (r *BuiltinRegistry) Lookup(name string) (Builtin, bool) {
+	b, ok := r.builtins[name]
+	if !ok || !available(b) {
+		return nil, false
+	}
+	return b, true
+}
+
+// All は登録されているビルトインコマンドのうち、使用できるものを名前順に返す
+func (r *BuiltinRegistry) All() []Builtin {
+	all := make([]Builtin, 0, len(r.builtins))
+	for _, b := range r.builtins {
+		if available(b) {
+			all = append(all, b)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Name() < all[j].Name()
+	})
+	return all
+}
+
+// runBuiltin はビルトインコマンドを実行し、結果を返す
+// セッションのロックを保持した状態で呼び出す
+func runBuiltin(ctx context.Context, b Builtin, session *Session, args []string, sessionID, cmd string) CommandResult {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String(traceAttr("builtin"), b.Name()))
+	commandsExecuted.Inc()
+
+	ctx, actions := withActions(ctx)
+	output, err := b.Run(ctx, session, args)
+	if err != nil {
+		reason := reasonBuiltin
+		if errors.Is(err, errInterrupted) {
+			reason = reasonInterrupted
+		}
+		commandsFailed.WithLabelValues(reason).Inc()
+		result := CommandResult{
+			Command:   cmd,
+			Result:    output,
+			Pwd:       session.CurrentDir,
+			Username:  session.Username,
+			SessionID: sessionID,
+			Actions:   actions.actions,
+			exitCode:  1,
+		}
+		result.setError(localeFrom(ctx), err)
+		return result
+	}
+	return CommandResult{
+		Status:    "success",
+		Command:   cmd,
+		Result:    output,
+		Pwd:       session.CurrentDir,
+		Username:  session.Username,
+		SessionID: sessionID,
+		Actions:   actions.actions,
+	}
+}
+
+// usageError は、ビルトインコマンドの使い方を示すエラーを作成
+// 使い方はヘルプと同じく、コンテキストの言語のものを使用する
+func usageError(ctx context.Context, b Builtin) error {
+	usage := translateOr(localeFrom(ctx), "help."+b.Name()+".usage", b.Usage())
+	return newMessageError("builtin.usage", param("command", b.Name()), param("usage", usage))
+}
+
+// shellOperator はコマンドラインに含まれる、クォートされていないシェルの演算子・展開を返す
+// 対象は ; & | < > ( ) ` $ と改行（&&・||・>> は2文字で返す）。ダブルクォート内の $ と ` も展開されるため含める
+// 含まれない場合は空文字列を返す
+func shellOperator(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+		case quote == '"':
+			switch c {
+			case '"':
+				quote = 0
+			case '\\':
+				i++
+			case '$', '`':
+				return string(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '\\':
+			i++
+		case strings.IndexByte(";&|<>()`$\n", c) >= 0:
+			if i+1 < len(line) && line[i+1] == c && strings.IndexByte("&|>", c) >= 0 {
+				return line[i : i+2]
+			}
+			return string(c)
+		}
+	}
+	return ""
+}
+
+// splitArgs はコマンドラインを引数に分割する
+// シングルクォート・ダブルクォート・バックスラッシュによるエスケープに対応する
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote == '\'':
+			// シングルクォート内はエスケープしない
+			if c == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(c)
+			}
+		case quote == '"':
+			switch {
+			case c == '"':
+				quote = 0
+			case c == '\\' && i+1 < len(runes) && strings.ContainsRune(`"\$`+"`", runes[i+1]):
+				i++
+				current.WriteRune(runes[i])
+			default:
+				current.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == '\\':
+			if i+1 < len(runes) {
+				i++
+				current.WriteRune(runes[i])
+			}
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, newMessageError("parse.unterminated_quote")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
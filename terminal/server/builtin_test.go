@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{line: "", want: nil},
+		{line: "   ", want: nil},
+		{line: "ls -la /tmp", want: []string{"ls", "-la", "/tmp"}},
+		{line: "  cd   works  ", want: []string{"cd", "works"}},
+		{line: `echo 'a  b' "c d"`, want: []string{"echo", "a  b", "c d"}},
+		{line: `echo 'a\nb'`, want: []string{"echo", `a\nb`}},
+		{line: `echo "a \"b\" \$c \d"`, want: []string{"echo", `a "b" $c \d`}},
+		{line: `echo a\ b`, want: []string{"echo", "a b"}},
+		{line: `echo ''`, want: []string{"echo", ""}},
+		{line: `echo a"b"'c'`, want: []string{"echo", "abc"}},
+		{line: `echo 'unterminated`, wantErr: true},
+		{line: `echo "unterminated`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := splitArgs(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("splitArgs(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !slices.Equal(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestShellOperator(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{line: "pwd", want: ""},
+		{line: "cd works", want: ""},
+		{line: "pwd && echo x", want: "&&"},
+		{line: "pwd || echo x", want: "||"},
+		{line: "export FOO=1; echo $FOO", want: ";"},
+		{line: "echo $HOME", want: "$"},
+		{line: "ls | wc -l", want: "|"},
+		{line: "sleep 1 &", want: "&"},
+		{line: "pwd >> out", want: ">>"},
+		{line: "cat < in", want: "<"},
+		{line: "echo `date`", want: "`"},
+		{line: "echo $(date)", want: "$"},
+		{line: "echo (x)", want: "("},
+		{line: "pwd\necho x", want: "\n"},
+		{line: `echo ';&|$'`, want: ""},
+		{line: `echo "a;b|c"`, want: ""},
+		{line: `echo "$HOME"`, want: "$"},
+		{line: `echo \; \$`, want: ""},
+		{line: `echo "\$HOME"`, want: ""},
+	}
+	for _, tt := range tests {
+		if got := shellOperator(tt.line); got != tt.want {
+			t.Errorf("shellOperator(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestValivateCommand(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want ErrorCode // 空の場合はエラーにならない
+	}{
+		{cmd: "ls -la", want: ""},
+		{cmd: "", want: ErrorEmptyCommand},
+		{cmd: " ", want: ErrorEmptyCommand},
+		{cmd: "\t \n", want: ErrorEmptyCommand},
+		{cmd: "shutdown now", want: ErrorPolicyDenied},
+		{cmd: "  rm -rf /", want: ErrorPolicyDenied},
+	}
+	for _, tt := range tests {
+		err := valivateCommand(tt.cmd)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("valivateCommand(%q) = %v, want nil", tt.cmd, err)
+		case tt.want != "" && (err == nil || errorCode(err) != tt.want):
+			t.Errorf("valivateCommand(%q) = %v, want %s", tt.cmd, err, tt.want)
+		}
+	}
+}
+
+func TestDispatcherRecoversPanic(t *testing.T) {
+	d := NewDispatcher(1, 1, func(ctx context.Context, payload *Payload) *CommandResult {
+		panic(errors.New("boom"))
+	})
+	result := d.safeHandle(context.Background(), &Payload{Command: "x", SessionID: "s", RequestID: "r"})
+	if result.Status != "error" || result.ErrorCode != ErrorInternal {
+		t.Fatalf("safeHandle() = %+v, want an INTERNAL_ERROR result", result)
+	}
+	if result.SessionID != "s" || result.RequestID != "r" {
+		t.Errorf("safeHandle() ids = %q/%q, want s/r", result.SessionID, result.RequestID)
+	}
+}
+
+// TestBuiltinExamples は、ビルトインコマンドの使用例がbashに渡されず、ビルトインコマンドとして実行されることを確認する
+func TestBuiltinExamples(t *testing.T) {
+	for _, b := range builtins.builtins {
+		detail, ok := b.(builtinDetail)
+		if !ok {
+			continue
+		}
+		for _, example := range detail.Examples() {
+			if op := shellOperator(example); op != "" {
+				t.Errorf("%s: example %q contains %q", b.Name(), example, op)
+			}
+		}
+	}
+}
+
+func TestSLStopError(t *testing.T) {
+	timeout, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want ErrorCode
+	}{
+		{name: "interrupted", ctx: canceledContext(errInterrupted), want: ErrorInterrupted},
+		{name: "killed", ctx: canceledContext(errSessionKilled), want: ErrorSessionKilled},
+		{name: "timeout", ctx: timeout, want: ErrorTimeout},
+		{name: "shutdown", ctx: canceledContext(nil), want: ErrorShuttingDown},
+	}
+	for _, tt := range tests {
+		<-tt.ctx.Done()
+		if got := errorCode(slStopError(tt.ctx)); got != tt.want {
+			t.Errorf("%s: errorCode(slStopError()) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// canceledContext は、causeを理由にキャンセルしたコンテキストを返す
+func canceledContext(cause error) context.Context {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(cause)
+	return ctx
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+func init() {
+	builtins.Register(cdBuiltin{})
+	builtins.Register(pwdBuiltin{})
+	builtins.Register(exportBuiltin{})
+	builtins.Register(unsetBuiltin{})
+	builtins.Register(aliasBuiltin{})
+	builtins.Register(unaliasBuiltin{})
+	builtins.Register(historyBuiltin{})
+	builtins.Register(clearBuiltin{})
+	builtins.Register(exitBuiltin{})
+}
+
+// 環境変数名・エイリアス名として使用できる文字列
+var (
+	envNamePattern   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	aliasNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]+$`)
+)
+
+// 画面を消去するエスケープシーケンス
+// カーソルを左上に移動し、画面とスクロールバックを消去する
+const clearScreen = "\x1b[H\x1b[2J\x1b[3J"
+
+// protectedEnv は、exportで変更できない環境変数
+// 実行するプログラムやbashの起動時の動作を変更し、ポリシーを回避できるものを含む
+var protectedEnv = map[string]bool{
+	"PATH":            true,
+	"BASH_ENV":        true,
+	"ENV":             true,
+	"SHELLOPTS":       true,
+	"BASHOPTS":        true,
+	"PROMPT_COMMAND":  true,
+	"PS4":             true,
+	"IFS":             true,
+	"LD_PRELOAD":      true,
+	"LD_LIBRARY_PATH": true,
+	"LD_AUDIT":        true,
+}
+
+// cdBuiltin は作業ディレクトリを変更するコマンド
+type cdBuiltin struct{}
+
+func (cdBuiltin) Name() string               { return "cd" }
+func (cdBuiltin) Usage() string              { return "cd [ディレクトリ | - | ~]" }
+func (cdBuiltin) Help() string               { return "作業ディレクトリを変更します" }
+func (cdBuiltin) Completion() completionKind { return completeDirs }
+
+func (cdBuiltin) Examples() []string {
+	return []string{"cd", "cd /tmp", "cd ..", "cd -", "cd ~"}
+}
+
+func (cdBuiltin) Options() []CommandOption {
+	return []CommandOption{
+		{Flag: "-", Description: "直前のディレクトリに移動します"},
+		{Flag: "~", Description: "ホームディレクトリに移動します"},
+	}
+}
+
+func (cdBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	// 引数がない場合はデフォルトディレクトリに移動(cdのみ)
+	if len(args) == 0 {
+		session.PreviousDir = session.CurrentDir // 現在のディレクトリを保存
+		session.CurrentDir = cfg.HomeDir
+		return "", nil
+	}
+
+	// cd - の特別処理
+	if args[0] == "-" {
+		// 直前のディレクトリが空の場合はエラー
+		if session.PreviousDir == "" {
+			return "", newMessageError("cd.no_previous")
+		}
+		// 現在のディレクトリと直前のディレクトリを入れ替え
+		session.PreviousDir, session.CurrentDir = session.CurrentDir, session.PreviousDir
+		return "", nil
+	}
+
+	dir := args[0]
+	// cd ~ の特別処理
+	if strings.HasPrefix(dir, "~") {
+		// ユーザーのホームディレクトリに移動
+		homeDir := session.homeDir()
+		if homeDir == "" {
+			return "", newMessageError("cd.no_home")
+		}
+		// ~をホームディレクトリに置き換え
+		dir = strings.Replace(dir, "~", homeDir, 1)
+	}
+
+	// 相対パスの場合は現在のディレクトリからの相対パスに変換
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(session.CurrentDir, dir)
+	}
+	// パスの正規化（..や.の解決）
+	newDir := filepath.Clean(dir)
+
+	// ディレクトリの存在確認
+	if err := session.fsys().Chdir(newDir); err != nil {
+		switch {
+		case errors.Is(err, fs.ErrPermission):
+			return "", newMessageError("cd.permission_denied", param("path", newDir))
+		case errors.Is(err, errNotDir):
+			return "", newMessageError("cd.not_a_directory", param("path", newDir))
+		}
+		return "", newMessageError("cd.not_found", param("path", newDir))
+	}
+
+	// ディレクトリの変更
+	session.PreviousDir = session.CurrentDir // 現在のディレクトリを保存
+	session.CurrentDir = newDir
+	return "", nil
+}
+
+// pwdBuiltin は作業ディレクトリを表示するコマンド
+type pwdBuiltin struct{}
+
+func (pwdBuiltin) Name() string               { return "pwd" }
+func (pwdBuiltin) Usage() string              { return "pwd" }
+func (pwdBuiltin) Help() string               { return "作業ディレクトリを表示します" }
+func (pwdBuiltin) Completion() completionKind { return completeNone }
+
+func (pwdBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	return session.CurrentDir, nil
+}
+
+// exportBuiltin はセッションの環境変数を設定するコマンド
+// 設定した環境変数は以降に実行するコマンドに引き継がれる
+type exportBuiltin struct{}
+
+func (exportBuiltin) Name() string               { return "export" }
+func (exportBuiltin) Usage() string              { return "export [名前[=値] ...]" }
+func (exportBuiltin) Help() string               { return "環境変数を設定・一覧表示します" }
+func (exportBuiltin) Completion() completionKind { return completeVariables }
+
+// COLUMNSは、catがMarkdownを整形する幅とslの幅に反映される
+func (exportBuiltin) Examples() []string {
+	return []string{"export GREETING=hello", "export", "export COLUMNS=60"}
+}
+
+func (exportBuiltin) Options() []CommandOption { return nil }
+
+func (exportBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	if len(args) == 0 {
+		names := sortedKeys(session.env)
+		lines := make([]string, 0, len(names))
+		for _, name := range names {
+			lines = append(lines, fmt.Sprintf("declare -x %s=%q", name, session.env[name]))
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+
+	for _, arg := range args {
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !envNamePattern.MatchString(name) {
+			return "", newMessageError("export.invalid_name", param("name", arg))
+		}
+		if protectedEnv[name] || strings.HasPrefix(name, "BASH_FUNC_") {
+			return "", newMessageError("export.protected", param("name", name))
+		}
+		// 値を指定しない場合は、未設定であれば空文字列を設定する
+		if !hasValue {
+			if _, exists := session.env[name]; exists {
+				continue
+			}
+		}
+		if session.env == nil {
+			session.env = make(map[string]string)
+		}
+		session.env[name] = value
+	}
+	return "", nil
+}
+
+// unsetBuiltin はセッションの環境変数を削除するコマンド
+type unsetBuiltin struct{}
+
+func (unsetBuiltin) Name() string               { return "unset" }
+func (unsetBuiltin) Usage() string              { return "unset 名前 ..." }
+func (unsetBuiltin) Help() string               { return "環境変数を削除します" }
+func (unsetBuiltin) Completion() completionKind { return completeVariables }
+
+func (unsetBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	for _, name := range args {
+		if name == "-v" {
+			continue
+		}
+		if strings.HasPrefix(name, "-") {
+			return "", newMessageError("builtin.invalid_option", param("command", "unset"), param("option", name))
+		}
+		delete(session.env, name)
+	}
+	return "", nil
+}
+
+// aliasBuiltin はセッションのエイリアスを設定するコマンド
+type aliasBuiltin struct{}
+
+func (aliasBuiltin) Name() string               { return "alias" }
+func (aliasBuiltin) Usage() string              { return "alias [名前[=値] ...]" }
+func (aliasBuiltin) Help() string               { return "エイリアスを設定・一覧表示します" }
+func (aliasBuiltin) Completion() completionKind { return completeAliases }
+
+func (aliasBuiltin) Examples() []string {
+	return []string{"alias", "alias ll='ls -l'", "alias ll"}
+}
+
+func (aliasBuiltin) Options() []CommandOption { return nil }
+
+func (aliasBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	if len(args) == 0 {
+		args = sortedKeys(session.aliases)
+	}
+
+	var lines []string
+	for _, arg := range args {
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !hasValue {
+			// 値を指定しない場合は設定を表示する
+			value, exists := session.aliases[name]
+			if !exists {
+				return strings.Join(lines, "\n"), newMessageError("alias.not_found", param("name", name))
+			}
+			lines = append(lines, fmt.Sprintf("alias %s='%s'", name, value))
+			continue
+		}
+
+		if !aliasNamePattern.MatchString(name) {
+			return "", newMessageError("alias.invalid_name", param("name", name))
+		}
+		// 展開後のコマンドがポリシーで許可されていることを確認する
+		if err := valivateCommand(value); err != nil {
+			return "", newMessageError("alias.invalid_value", param("name", name), err)
+		}
+		if session.aliases == nil {
+			session.aliases = make(map[string]string)
+		}
+		session.aliases[name] = value
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// unaliasBuiltin はセッションのエイリアスを削除するコマンド
+type unaliasBuiltin struct{}
+
+func (unaliasBuiltin) Name() string               { return "unalias" }
+func (unaliasBuiltin) Usage() string              { return "unalias [-a] 名前 ..." }
+func (unaliasBuiltin) Help() string               { return "エイリアスを削除します" }
+func (unaliasBuiltin) Completion() completionKind { return completeAliases }
+
+func (unaliasBuiltin) Examples() []string {
+	return []string{"unalias ll", "unalias -a"}
+}
+
+func (unaliasBuiltin) Options() []CommandOption {
+	return []CommandOption{
+		{Flag: "-a", Description: "すべてのエイリアスを削除します"},
+	}
+}
+
+func (unaliasBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	if len(args) == 0 {
+		return "", usageError(ctx, unaliasBuiltin{})
+	}
+	for _, name := range args {
+		if name == "-a" {
+			session.aliases = nil
+			continue
+		}
+		if _, exists := session.aliases[name]; !exists {
+			return "", newMessageError("unalias.not_found", param("name", name))
+		}
+		delete(session.aliases, name)
+	}
+	return "", nil
+}
+
+// clearBuiltin は画面を消去するコマンド
+type clearBuiltin struct{}
+
+func (clearBuiltin) Name() string               { return "clear" }
+func (clearBuiltin) Usage() string              { return "clear" }
+func (clearBuiltin) Help() string               { return "画面を消去します" }
+func (clearBuiltin) Completion() completionKind { return completeNone }
+
+// Run は画面を消去する
+// 操作に対応したフロントエンドはclearの操作で、それ以外の端末はエスケープシーケンスで消去する
+func (clearBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	if err := emitAction(ctx, Action{Type: ActionClear}); err != nil {
+		return "", err
+	}
+	return clearScreen, nil
+}
+
+// exitBuiltin はセッションを終了するコマンド
+// 作業ディレクトリ・環境変数・エイリアス・履歴は破棄され、次のコマンドでは新しいセッションが作成される
+type exitBuiltin struct{}
+
+func (exitBuiltin) Name() string               { return "exit" }
+func (exitBuiltin) Usage() string              { return "exit" }
+func (exitBuiltin) Help() string               { return "セッションを終了します" }
+func (exitBuiltin) Completion() completionKind { return completeNone }
+
+func (exitBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	// セッションの破棄は実行後に呼び出し元（executeCommand）で行う
+	session.exited = true
+	return "logout", nil
+}
+
+// sortedKeys はマップのキーを昇順に返す
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
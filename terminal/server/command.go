@@ -1,142 +1,141 @@
 package main
 
 import (
-	"fmt"
-	"log"
-	"os"
+	"bytes"
+	"context"
+	"errors"
+	"io"
 	"os/exec"
-	"path/filepath"
 	"strings"
+	"time"
 
-	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// cdコマンドの特殊な処理を行う関数
+// 強制終了したコマンドの出力パイプが閉じられるまで待機する最大時間
+const commandWaitDelay = 2 * time.Second
+
+// 通常のコマンドを実行する関数
 // 引数としてセッションとコマンドの分割結果を受け取る
-func executeCD(session *Session, parts []string,sessionID string,cmd string) (CommandResult, error) {
-	// 引数が1つの場合はデフォルトディレクトリに移動(cdのみ)
-	if len(parts) == 1 {
-		// cdのみの場合はデフォルトディレクトリに移動
-		session.PreviousDir = session.CurrentDir // 現在のディレクトリを保存
-		session.CurrentDir = "/home/nonroot"
-		return CommandResult{
-			Status:    "success",
+// コンテキストがキャンセルされた場合（シャットダウンの猶予期間切れなど）はプロセスを強制終了する
+func executeNormalCommand(ctx context.Context, session *Session,sessionID string,cmd string) (CommandResult, error) {
+		cmdObj := exec.CommandContext(ctx, "bash","-l", "-c", cmd)
+	// 作業ディレクトリはシェルのコマンドラインに含めず、プロセスの作業ディレクトリとして指定する
+	// （ディレクトリ名の空白や ; がシェルに解釈されないようにする）
+	cmdObj.Dir = session.CurrentDir
+	// 強制終了後、子プロセスが出力パイプを保持し続けても待機し続けないようにする
+	cmdObj.WaitDelay = commandWaitDelay
+	// 許可したサーバーの環境変数と、exportで設定した環境変数を引き継ぐ
+	// コマンドがメッセージの言語に合わせて出力できるよう、言語も渡す
+	cmdObj.Env = session.environ(localeFrom(ctx))
+	logger := loggerFrom(ctx)
+
+	// 標準出力と標準エラー出力をまとめて受け取る
+	// 録画中の場合は、出力を受け取るたびに録画にも書き込む
+	var buf bytes.Buffer
+	var out io.Writer = &buf
+	if session.recorder != nil {
+		out = io.MultiWriter(&buf, session.recorder)
+	}
+	cmdObj.Stdout = out
+	cmdObj.Stderr = out
+
+	start := time.Now()
+	err := cmdObj.Run()
+	output := buf.Bytes()
+	outputStr := strings.TrimSpace(string(output))
+	duration := time.Since(start)
+
+	commandsExecuted.Inc()
+	commandDuration.Observe(duration.Seconds())
+	commandOutputBytes.Observe(float64(len(output)))
+	exitCode := cmdObj.ProcessState.ExitCode()
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int(traceAttr("exit_code"), exitCode),
+		attribute.Int(traceAttr("output_bytes"), len(output)),
+	)
+
+	// タイムアウトによって強制終了された場合
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && err != nil {
+		logger.Warn("コマンドがタイムアウトしました", "timeout", cfg.CommandTimeout)
+		commandsFailed.WithLabelValues(reasonTimeout).Inc()
+		result := CommandResult{
 			Command:   cmd,
-			Result:    "",
+			Result:    outputStr,
 			Pwd:       session.CurrentDir,
-			Username:  session.Username,  // ユーザー名を結果に含める
+			Username:  session.Username,
 			SessionID: sessionID,
-		}, nil
+			exitCode:  exitCode,
+		}
+		result.setError(localeFrom(ctx), newMessageError("error.timeout", param("timeout", cfg.CommandTimeout.String())))
+		return result, nil
 	}
 
-	// cd - の特別処理
-	if parts[1] == "-" {
-		// 直前のディレクトリが空の場合はエラー
-		if session.PreviousDir == "" {
-			return CommandResult{
-				Status:    "error",
-				Command:   cmd,
-				Error:     "直前のディレクトリがありません",
-				Pwd:       session.CurrentDir,
-				Username:  session.Username,  // ユーザー名を結果に含める
-				SessionID: sessionID,
-			}, nil
-		}
-		// 現在のディレクトリと直前のディレクトリを入れ替え
-		session.PreviousDir, session.CurrentDir = session.CurrentDir, session.PreviousDir
-		return CommandResult{
-			Status:    "success",
+	// 管理APIからセッションが終了された場合
+	if errors.Is(context.Cause(ctx), errSessionKilled) && err != nil {
+		logger.Warn("セッションの終了によりコマンドを強制終了")
+		commandsFailed.WithLabelValues(reasonKilled).Inc()
+		result := CommandResult{
 			Command:   cmd,
-			Result:    "",
+			Result:    outputStr,
 			Pwd:       session.CurrentDir,
 			Username:  session.Username,
 			SessionID: sessionID,
-		}, nil
-	}
-
-	// cd ~ の特別処理
-	if strings.HasPrefix(parts[1], "~") {
-		// ユーザーのホームディレクトリに移動
-		homeDir := os.Getenv("HOME")
-		if homeDir == "" {
-			return CommandResult{
-				Status:    "error",
-				Command:   cmd,
-				Error:     "ホームディレクトリが取得できません",
-				Pwd:       session.CurrentDir,
-				Username:  session.Username,  // ユーザー名を結果に含める
-				SessionID: sessionID,
-			}, nil
+			exitCode:  exitCode,
 		}
-		// ~をホームディレクトリに置き換え
-		parts[1] = strings.Replace(parts[1], "~", homeDir, 1)
-	}
-
-	// 通常のcdコマンド処理
-	// 相対パスの場合は現在のディレクトリからの相対パスに変換
-	if !strings.HasPrefix(parts[1], "/") {
-		parts[1] = filepath.Join(session.CurrentDir, parts[1])
+		result.setError(localeFrom(ctx), errSessionKilled)
+		return result, nil
 	}
-	// パスの正規化（..や.の解決）
-	newDir := filepath.Clean(parts[1])
 
-	// ディレクトリの存在確認
-	fileInfo, err := os.Stat(newDir)
-	if err != nil {
-		return CommandResult{
-			Status:    "error",
+	// クライアントから中断（Ctrl-C）された場合
+	if errors.Is(context.Cause(ctx), errInterrupted) && err != nil {
+		logger.Info("クライアントからの中断によりコマンドを強制終了")
+		commandsFailed.WithLabelValues(reasonInterrupted).Inc()
+		result := CommandResult{
 			Command:   cmd,
-			Error:     fmt.Sprintf("ディレクトリが存在しません: %s", newDir),
+			Result:    outputStr,
 			Pwd:       session.CurrentDir,
-			Username:  session.Username,  // ユーザー名を結果に含める
+			Username:  session.Username,
 			SessionID: sessionID,
-		}, nil
+			exitCode:  130,
+		}
+		result.setError(localeFrom(ctx), errInterrupted)
+		return result, nil
 	}
 
-	// 入手した情報がディレクトリかどうかを確認
-	if !fileInfo.IsDir() {
-		return CommandResult{
-			Status:    "error",
+	// コンテキストのキャンセルによって強制終了された場合
+	if ctx.Err() != nil && err != nil {
+		logger.Warn("コマンドを強制終了", "error", ctx.Err())
+		commandsFailed.WithLabelValues(reasonCanceled).Inc()
+		result := CommandResult{
 			Command:   cmd,
-			Error:     fmt.Sprintf("ディレクトリが存在しません: %s", newDir),
+			Result:    outputStr,
 			Pwd:       session.CurrentDir,
-			Username:  session.Username,  // ユーザー名を結果に含める
+			Username:  session.Username,
 			SessionID: sessionID,
-		}, nil
+			exitCode:  exitCode,
+		}
+		result.setError(localeFrom(ctx), newMessageError("error.canceled"))
+		return result, nil
 	}
 
-	// ディレクトリの変更
-	session.PreviousDir = session.CurrentDir // 現在のディレクトリを保存
-	session.CurrentDir = newDir
-	return CommandResult{
-		Status:    "success",
-		Command:   cmd,
-		Result:    "",
-		Pwd:       session.CurrentDir,
-		Username:  session.Username,  // ユーザー名を結果に含める
-		SessionID: sessionID,
-	}, nil
-}
-
-// 通常のコマンドを実行する関数
-// 引数としてセッションとコマンドの分割結果を受け取る
-func executeNormalCommand(session *Session,sessionID string,cmd string) (CommandResult, error) {
-		cmdObj := exec.Command("bash","-l", "-c", fmt.Sprintf("cd %s && %s", session.CurrentDir, cmd))
-	output, err := cmdObj.CombinedOutput()
-	outputStr := strings.TrimSpace(string(output))
-
 	if err != nil {
 		// エラー発生時の処理
-		log.Printf("コマンド実行エラー: %v, 出力: %s", err, outputStr)
-		return CommandResult{
-			Status:    "error",
+		logger.Info("コマンド実行エラー", "error", err, "duration_ms", duration.Milliseconds(), "output_bytes", len(output))
+		logger.Debug("コマンドの出力", "output", outputStr)
+		commandsFailed.WithLabelValues(reasonExitStatus).Inc()
+		result := CommandResult{
 			Command:   cmd,
-			Error:     fmt.Sprintf("コマンド実行エラー: %v", err),
 			Result:    outputStr,
 			Pwd:       session.CurrentDir,
 			Username:  session.Username,  // ユーザー名を結果に含める
 			SessionID: sessionID,
-		}, nil
+			exitCode:  exitCode,
+		}
+		result.setError(localeFrom(ctx), newMessageError("error.exit_status", param("exit_code", exitCode)))
+		return result, nil
 	}
 
 	// 成功時の結果を返却
@@ -147,47 +146,189 @@ func executeNormalCommand(session *Session,sessionID string,cmd string) (Command
 		Pwd:       session.CurrentDir,
 		Username:  session.Username,  // ユーザー名を結果に含める
 		SessionID: sessionID,
+		exitCode:  exitCode,
 	}
-	log.Printf("コマンド実行成功: %+v", result)
+	logger.Info("コマンド実行成功", "duration_ms", duration.Milliseconds(), "output_bytes", len(output))
+	logger.Debug("コマンドの出力", "output", outputStr)
 	return result, nil
 }
 
 
 // executeCommand は、指定されたコマンドを実行し、結果を返す
-// cdコマンドは特別に処理され、セッションの現在ディレクトリを更新
+// ビルトインコマンド（cdなど）はGoで実行し、セッションの状態を直接更新する
 // その他のコマンドは、セッションの現在ディレクトリで実行される
-func executeCommand(cmd string, sessionID string) (CommandResult, error) {
-
-	// セッションIDが指定されていない場合は新規作成
-	if sessionID == "" {
-		sessionID = uuid.New().String()
-		log.Printf("新規セッションIDを生成: %s", sessionID)
-	}
+// セッションIDは呼び出し元（decodeMessage）で必ず設定される
+func executeCommand(ctx context.Context, payload *Payload) (result CommandResult, err error) {
+	cmd, sessionID := payload.Command, payload.SessionID
 
 	// セッションの取得
-	session, err := sessionManager.GetSession(sessionID)
+	session, err := sessionManager.GetSession(ctx, sessionID)
 	if err != nil {
-		return CommandResult{
-			Status:    "error",
+		commandsFailed.WithLabelValues(reasonSessionError).Inc()
+		result = CommandResult{
 			Command:   cmd,
-			Error:     "セッションエラー: " + err.Error(),
 			SessionID: sessionID,
-		}, nil
+		}
+		result.setError(localeFrom(ctx), newMessageError("error.session", err))
+		return result, nil
 	}
 
 	// セッションの排他制御
 	session.mu.Lock()
 	defer session.mu.Unlock()
 
-	// コマンドを空白で分割して解析
-	parts := strings.Fields(cmd)
+	// 他のプロセスで同じセッションのコマンドを実行していた場合は、その状態を引き継ぐ
+	sessionManager.refreshSession(ctx, session)
 
-	// cdコマンドの処理
-	if len(parts) > 0 && parts[0] == "cd" {
-		return executeCD(session, parts, sessionID, cmd)
+	// 言語が指定された場合は、以降のリクエストでも同じ言語を使用する
+	if locale := negotiateLocale(payload.Locale); locale != "" {
+		session.setLocale(locale)
+	}
+
+	// 実行の開始と結果をセッションに記録する
+	ctx = session.beginCommand(ctx, payload.Client)
+	start := time.Now()
+	defer func() {
+		session.endCommand(cmd, result, start)
+		// exitで終了したセッションは保存しない
+		// 他のプロセスが状態の更新を検出した時点で書き込みも読み込めるよう、書き込みを先に保存する
+		if !session.exited {
+			sessionManager.saveOverlay(ctx, session)
+			sessionManager.saveSession(ctx, session)
+		}
+	}()
+
+	// 録画中の場合はコマンドとエラーを記録する（出力はexecuteNormalCommandで記録）
+	session.updateRecording(payload.Record)
+	if recorder := session.recorder; recorder != nil {
+		recorder.Command(session.Username, session.CurrentDir, cmd)
+		defer func() {
+			if result.Error != "" {
+				recorder.Message("\x1b[31m" + result.Error + "\x1b[0m")
+			}
+		}()
+	}
+
+	ctx, span := tracer.Start(ctx, "execute")
+	defer span.End()
+
+	// エイリアスを展開する
+	// 展開後のコマンドもポリシーで許可されていることを確認する
+	line := session.expandAlias(cmd)
+	if line != cmd {
+		if err := valivateCommand(line); err != nil {
+			commandsRejected.WithLabelValues(reasonValidation).Inc()
+			span.SetStatus(codes.Error, err.Error())
+			result = CommandResult{
+				Command:   cmd,
+				Pwd:       session.CurrentDir,
+				Username:  session.Username,
+				SessionID: sessionID,
+				exitCode:  1,
+			}
+			result.setError(localeFrom(ctx), newMessageError("error.validation", err))
+			return result, nil
+		}
+	}
+
+	// 仮想ファイルシステムでは、ビルトインコマンドの出力をファイルにリダイレクトできる
+	// （ホストのファイルシステムではbashがリダイレクトを処理する）
+	var redirect *outputRedirect
+	if virtualFS() {
+		var err error
+		line, redirect, err = cutRedirect(line)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			result = CommandResult{
+				Command:   cmd,
+				Pwd:       session.CurrentDir,
+				Username:  session.Username,
+				SessionID: sessionID,
+				exitCode:  2,
+			}
+			result.setError(localeFrom(ctx), newMessageError("error.syntax", err))
+			return result, nil
+		}
+	}
+
+	// シェルの演算子・展開（;・&&・|・$VAR など）を含む行は、ビルトインコマンドでは実行しない
+	// ホストのファイルシステムではbashで実行し、仮想ファイルシステムでは行の一部を無視しないようエラーにする
+	operator := shellOperator(line)
+	if operator != "" && virtualFS() {
+		err := newMessageError("error.shell_operator", param("operator", operator))
+		commandsRejected.WithLabelValues(reasonValidation).Inc()
+		span.SetStatus(codes.Error, err.Error())
+		result = CommandResult{
+			Command:   cmd,
+			Pwd:       session.CurrentDir,
+			Username:  session.Username,
+			SessionID: sessionID,
+			exitCode:  2,
+		}
+		result.setError(localeFrom(ctx), err)
+		return result, nil
+	}
+
+	// ビルトインコマンドが登録されている場合はbashを起動せずに実行する
+	if name, _, _ := strings.Cut(strings.TrimSpace(line), " "); name != "" && operator == "" {
+		if b, ok := builtins.Lookup(name); ok {
+			args, err := splitArgs(line)
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+				result = CommandResult{
+					Command:   cmd,
+					Pwd:       session.CurrentDir,
+					Username:  session.Username,
+					SessionID: sessionID,
+					exitCode:  1,
+				}
+				result.setError(localeFrom(ctx), newMessageError("error.command", param("command", name), err))
+				return result, nil
+			}
+			result = runBuiltin(ctx, b, session, args[1:], sessionID, cmd)
+			if redirect != nil && result.Status == "success" {
+				if err := redirect.write(session, result.Result); err != nil {
+					commandsFailed.WithLabelValues(reasonBuiltin).Inc()
+					result.setError(localeFrom(ctx), newMessageError("redirect.write_failed", param("command", name), param("path", redirect.target), err))
+					result.exitCode = 1
+				}
+				// 出力をファイルに書き込んだ場合は、画面の消去などの操作も行わない
+				result.Result = ""
+				result.Actions = nil
+			}
+			if result.Status == "error" {
+				span.SetStatus(codes.Error, result.Error)
+			}
+			// exitで終了した場合はセッションを破棄する
+			if session.exited {
+				sessionManager.End(session)
+			}
+			return result, nil
+		}
+	}
+
+	// 仮想ファイルシステムモードではbashを起動せず、ビルトインコマンドのみを実行できる
+	if virtualFS() {
+		name, _, _ := strings.Cut(strings.TrimSpace(line), " ")
+		err := newMessageError("error.command_not_found", param("command", name))
+		commandsRejected.WithLabelValues(reasonNotFound).Inc()
+		span.SetStatus(codes.Error, err.Error())
+		result = CommandResult{
+			Command:   cmd,
+			Pwd:       session.CurrentDir,
+			Username:  session.Username,
+			SessionID: sessionID,
+			exitCode:  127,
+		}
+		result.setError(localeFrom(ctx), err)
+		return result, nil
 	}
 
 	// 通常のコマンド実行
 	// 現在のディレクトリでコマンドを実行
-	return executeNormalCommand(session, sessionID, cmd)
+	result, err = executeNormalCommand(ctx, session, sessionID, line)
+	if result.Status == "error" {
+		span.SetStatus(codes.Error, result.Error)
+	}
+	return result, err
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCommandEnviron は、サーバーの設定の環境変数がコマンドに引き継がれないことを確認する
+func TestCommandEnviron(t *testing.T) {
+	t.Setenv("REDIS_PASSWORD", "secret")
+	t.Setenv("REDIS_URL", "redis://:secret@localhost:6379")
+	t.Setenv("TERMINAL_ADMIN_TOKEN", "token")
+	session := &Session{CurrentDir: t.TempDir(), env: map[string]string{"GREETING": "hello"}}
+
+	result, err := executeNormalCommand(context.Background(), session, "s", "env")
+	if err != nil || result.Status != "success" {
+		t.Fatalf("executeNormalCommand() = %+v, %v", result, err)
+	}
+	vars := make(map[string]string)
+	for _, line := range strings.Split(result.Result, "\n") {
+		name, value, _ := strings.Cut(line, "=")
+		vars[name] = value
+	}
+	for name := range vars {
+		if strings.HasPrefix(name, "REDIS_") || strings.HasPrefix(name, "TERMINAL_") && name != "TERMINAL_LOCALE" {
+			t.Errorf("%s is passed to the command", name)
+		}
+	}
+	if vars["GREETING"] != "hello" {
+		t.Errorf("GREETING = %q, want hello", vars["GREETING"])
+	}
+	if vars["TERMINAL_LOCALE"] != defaultLocale {
+		t.Errorf("TERMINAL_LOCALE = %q, want %s", vars["TERMINAL_LOCALE"], defaultLocale)
+	}
+}
+
+// TestCommandDir は、作業ディレクトリの名前がシェルに解釈されないことを確認する
+func TestCommandDir(t *testing.T) {
+	tmp := t.TempDir()
+	for _, name := range []string{"a b", "x;touch pwned;y", "$(touch pwned)", "'q'"} {
+		dir := filepath.Join(tmp, name)
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		session := &Session{CurrentDir: dir}
+		result, err := executeNormalCommand(context.Background(), session, "s", "pwd")
+		if err != nil || result.Status != "success" {
+			t.Errorf("%q: executeNormalCommand() = %+v, %v", name, result, err)
+			continue
+		}
+		// ログインシェルのプロファイルが出力するものは除き、最後の行を比較する
+		lines := strings.Split(result.Result, "\n")
+		if got := lines[len(lines)-1]; got != dir {
+			t.Errorf("%q: pwd = %q, want %q", name, got, dir)
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(tmp, "*", "pwned")); len(matches) > 0 {
+		t.Errorf("injected command ran: %v", matches)
+	}
+	if _, err := os.Stat("pwned"); err == nil {
+		os.Remove("pwned")
+		t.Error("injected command ran in the working directory")
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 1回の補完で返す候補の最大数
+// 候補が多すぎる場合は、先頭から（名前順）この件数までを返す
+const maxCompletions = 200
+
+// シェルで特別な意味を持つため、補完候補に含まれる場合はエスケープする文字
+const completionEscapeChars = " \t\\'\"$`&|;()<>*?!#"
+
+// Completion は、Tabによる補完の結果を表す構造体
+// 位置は文字（rune）単位で、クライアントはcommandの[Start, End)をCommonPrefixまたは選択した候補に置き換える
+type Completion struct {
+	Candidates   []string `json:"candidates"`          // 補完候補（置き換える単語全体、エスケープ済み）
+	CommonPrefix string   `json:"common_prefix"`       // 候補に共通する接頭辞
+	Display      []string `json:"display"`             // 一覧表示用の候補（パスはファイル名のみ、ディレクトリは末尾に/）
+	Start        int      `json:"start"`               // 置き換える単語の開始位置
+	End          int      `json:"end"`                 // 置き換える単語の終了位置（カーソル位置）
+	Truncated    bool     `json:"truncated,omitempty"` // 候補が多すぎるため一部のみを返したかどうか
+}
+
+// completionCandidate は、補完候補1件を表す構造体
+type completionCandidate struct {
+	value   string // 置き換える単語全体
+	display string // 一覧表示用の文字列
+}
+
+// completeCommand はcompleteメッセージを処理し、カーソル位置の単語の補完候補を返す
+// コマンドは実行しないため、履歴や録画には記録しない
+func completeCommand(ctx context.Context, payload *Payload) (CommandResult, error) {
+	ctx, span := tracer.Start(ctx, "complete")
+	defer span.End()
+
+	session, err := sessionManager.GetSession(ctx, payload.SessionID)
+	if err != nil {
+		recordSpanError(span, err)
+		return CommandResult{}, err
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	line := []rune(payload.Command)
+	cursor := len(line)
+	if payload.Cursor != nil && *payload.Cursor >= 0 && *payload.Cursor < cursor {
+		cursor = *payload.Cursor
+	}
+	completion := session.complete(line[:cursor])
+
+	return CommandResult{
+		Status:     "success",
+		Command:    payload.Command,
+		Pwd:        session.CurrentDir,
+		Username:   session.Username,
+		SessionID:  payload.SessionID,
+		Completion: completion,
+	}, nil
+}
+
+// complete はカーソルより前の文字列から、補完する単語と候補を求める
+// セッションのロックを保持した状態で呼び出す
+func (s *Session) complete(before []rune) *Completion {
+	// 補完する単語と、単語が属するコマンドの開始位置を求める
+	// パイプや ; の後ろは新しいコマンドとして扱う
+	start, cmdStart := 0, 0
+	for i := 0; i < len(before); i++ {
+		switch before[i] {
+		case '\\':
+			i++
+		case ' ', '\t':
+			start = i + 1
+		case '|', ';', '&':
+			start, cmdStart = i+1, i+1
+		}
+	}
+	start = min(start, len(before))
+	word := unescapeCompletion(string(before[start:]))
+
+	var candidates []completionCandidate
+	fields := strings.Fields(string(before[cmdStart:start]))
+	switch {
+	case len(fields) == 0 && !strings.ContainsRune(word, '/') && !strings.HasPrefix(word, "~"):
+		// コマンド名の位置ではコマンド・ビルトインコマンド・エイリアスを補完する
+		candidates = s.completeCommandNames(word)
+	case len(fields) == 0:
+		candidates = s.completePaths(word, false)
+	default:
+		kind := completePaths
+		if b, ok := builtins.Lookup(fields[0]); ok {
+			kind = b.Completion()
+		}
+		candidates = s.completeArgument(kind, word)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].value < candidates[j].value
+	})
+	completion := &Completion{
+		Candidates: make([]string, 0, len(candidates)),
+		Display:    make([]string, 0, len(candidates)),
+		Start:      start,
+		End:        len(before),
+	}
+	if len(candidates) > maxCompletions {
+		candidates = candidates[:maxCompletions]
+		completion.Truncated = true
+	}
+	for _, c := range candidates {
+		completion.Candidates = append(completion.Candidates, c.value)
+		completion.Display = append(completion.Display, c.display)
+	}
+	completion.CommonPrefix = commonPrefix(completion.Candidates)
+	return completion
+}
+
+// completeArgument は引数の位置の単語を、補完方法に応じて補完する
+func (s *Session) completeArgument(kind completionKind, word string) []completionCandidate {
+	switch kind {
+	case completePaths:
+		return s.completePaths(word, false)
+	case completeDirs:
+		return s.completePaths(word, true)
+	case completeVariables:
+		return completeNames(sortedKeys(s.env), word)
+	case completeAliases:
+		return completeNames(sortedKeys(s.aliases), word)
+	case completeCommands:
+		return s.completeCommandNames(word)
+	default:
+		return nil
+	}
+}
+
+// completeCommandNames はポリシーで許可されたコマンド・ビルトインコマンド・エイリアスの名前を補完する
+func (s *Session) completeCommandNames(word string) []completionCandidate {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		if !seen[name] && strings.HasPrefix(name, word) {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for _, b := range builtins.All() {
+		if policy.Allows(b.Name()) {
+			add(b.Name())
+		}
+	}
+	for name := range s.aliases {
+		add(name)
+	}
+	switch {
+	case virtualFS():
+		// 仮想ファイルシステムモードではビルトインコマンドのみを実行できる
+	case len(policy.AllowedCommands) > 0:
+		// 許可リストがある場合は、リストにあるコマンドのみを候補にする
+		for _, name := range policy.AllowedCommands {
+			if policy.Allows(name) {
+				add(name)
+			}
+		}
+	default:
+		// 許可リストがない場合は、PATH上の実行可能なファイルのうち拒否されていないものを候補にする
+		for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				if !strings.HasPrefix(entry.Name(), word) || !policy.Allows(entry.Name()) {
+					continue
+				}
+				info, err := os.Stat(filepath.Join(dir, entry.Name()))
+				if err != nil || info.IsDir() || info.Mode()&0o111 == 0 {
+					continue
+				}
+				add(entry.Name())
+			}
+		}
+	}
+	return completeNames(names, word)
+}
+
+// completePaths は作業ディレクトリからの相対パス・絶対パス・~から始まるパスを補完する
+// dirsOnlyの場合はディレクトリのみを候補にする
+func (s *Session) completePaths(word string, dirsOnly bool) []completionCandidate {
+	// ~のみの場合はホームディレクトリ自体を補完する
+	if word == "~" {
+		return []completionCandidate{{value: "~/", display: "~/"}}
+	}
+
+	// 入力済みのディレクトリ部分と、補完するファイル名の部分に分ける
+	dirPart, base := "", word
+	if i := strings.LastIndex(word, "/"); i >= 0 {
+		dirPart, base = word[:i+1], word[i+1:]
+	}
+
+	// 読み込むディレクトリを求める
+	dir := dirPart
+	if strings.HasPrefix(dir, "~/") {
+		home := s.homeDir()
+		if home == "" {
+			return nil
+		}
+		dir = filepath.Join(home, dir[2:])
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(s.CurrentDir, dir)
+	}
+	entries, err := s.fsys().ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var candidates []completionCandidate
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) {
+			continue
+		}
+		// 隠しファイルは.から入力した場合のみ候補にする
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			// シンボリックリンクはリンク先がディレクトリかどうかで判定する
+			if info, err := s.fsys().Stat(filepath.Join(dir, name)); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		if dirsOnly && !isDir {
+			continue
+		}
+		suffix := ""
+		if isDir {
+			suffix = "/"
+		}
+		candidates = append(candidates, completionCandidate{
+			value:   escapeCompletion(dirPart+name) + suffix,
+			display: name + suffix,
+		})
+	}
+	return candidates
+}
+
+// completeNames は名前の一覧から、単語で始まるものを候補にする
+func completeNames(names []string, word string) []completionCandidate {
+	var candidates []completionCandidate
+	for _, name := range names {
+		if strings.HasPrefix(name, word) {
+			candidates = append(candidates, completionCandidate{value: escapeCompletion(name), display: name})
+		}
+	}
+	return candidates
+}
+
+// commonPrefix は候補に共通する接頭辞を返す
+func commonPrefix(candidates []string) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+	prefix := []rune(candidates[0])
+	for _, c := range candidates[1:] {
+		r := []rune(c)
+		n := 0
+		for n < len(prefix) && n < len(r) && prefix[n] == r[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return string(prefix)
+}
+
+// escapeCompletion はシェルで特別な意味を持つ文字をバックスラッシュでエスケープする
+func escapeCompletion(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(completionEscapeChars, c) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// unescapeCompletion は入力済みの単語からエスケープとクォートを取り除く
+func unescapeCompletion(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; {
+		case c == '\\' && i+1 < len(runes):
+			i++
+			b.WriteRune(runes[i])
+		case c == '\'' || c == '"':
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
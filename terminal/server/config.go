@@ -0,0 +1,570 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config は、サーバーの実行時設定を表す構造体
+// 優先順位は フラグ > 環境変数 > 設定ファイル > デフォルト値
+type Config struct {
+	Transport       string        `json:"transport"`          // 使用するトランスポート（redis / websocket / stdio）
+	Listen          string        `json:"listen"`             // WebSocketサーバーの待ち受けアドレス
+	WSPath          string        `json:"ws_path"`            // WebSocketエンドポイントのパス
+	WSOrigins       []string      `json:"ws_origins"`         // WebSocket接続を許可するオリジン（空の場合は同一オリジンのみ許可）
+	Redis           RedisConfig   `json:"redis"`              // Redisの接続設定
+	CommandTimeout  time.Duration `json:"command_timeout"`    // コマンド実行のタイムアウト（0の場合は無制限）
+	ShutdownGrace   time.Duration `json:"shutdown_grace"`     // シャットダウン時に実行中のコマンドの完了を待つ猶予期間
+	MaxOutputSize   int           `json:"max_output_size"`    // コマンドの実行結果の最大サイズ（バイト）
+	MaxSessions     int           `json:"max_sessions"`       // 同時に保持するセッションの最大数（0の場合は無制限）
+	HomeDir         string        `json:"home_dir"`           // セッションの初期ディレクトリ（cdのみの移動先）
+	FSMode          string        `json:"fs_mode"`            // ファイルシステム（host / virtual）
+	Locale          string        `json:"locale"`             // メッセージのデフォルトの言語（ja / en、リクエストで指定されない場合に使用）
+	OverlayStore    string        `json:"overlay_store"`      // 仮想ファイルシステムへの書き込みの保存先（off / memory / redis）
+	OverlayTTL      time.Duration `json:"overlay_ttl"`        // Redisに保存した書き込みの有効期限（0の場合は無期限）
+	OverlayMaxFiles int           `json:"overlay_max_files"`  // セッションごとに書き込めるファイル数（0の場合は無制限）
+	OverlayMaxBytes int           `json:"overlay_max_bytes"`  // セッションごとに書き込める容量（バイト、0の場合は無制限）
+	ActionOrigins   []string      `json:"action_origins"`     // コマンドがフロントエンドに開かせることができるURLのオリジン（例: https://github.com）
+	ImageMaxSize    int           `json:"image_max_size"`     // catで表示する画像の最大サイズ（バイト）
+	PolicyPath      string        `json:"policy_path"`        // コマンドポリシーファイルのパス（空の場合は組み込みのポリシー）
+	MetricsListen   string        `json:"metrics_listen"`     // メトリクスサーバーの待ち受けアドレス（空の場合は無効）
+	MetricsPath     string        `json:"metrics_path"`       // メトリクスエンドポイントのパス
+	Workers         int           `json:"workers"`            // コマンドを並行して処理するワーカーの数
+	WorkerQueueSize int           `json:"worker_queue_size"`  // ワーカーごとの処理待ちキューの長さ
+	HealthListen    string        `json:"health_listen"`      // ヘルスチェック（/healthz, /readyz）の待ち受けアドレス（空の場合は無効）
+	AdminListen     string        `json:"admin_listen"`       // 管理API（/admin/）の待ち受けアドレス（空の場合は無効）
+	AdminToken      string        `json:"admin_token"`        // 管理APIの認証トークン（Authorization: Bearer）
+	AdminTokenFile  string        `json:"admin_token_file"`   // 認証トークンを読み込むファイル（Docker secretsなど）
+	SessionStore    string        `json:"session_store"`      // セッションの状態の保存先（memory / redis）
+	SessionTTL      time.Duration `json:"session_ttl"`        // 保存したセッションの状態の有効期限（0の場合は無期限）
+	HistorySize     int           `json:"history_size"`       // セッションごとに保持するコマンド履歴の件数
+	RecordMode      string        `json:"record_mode"`        // セッションの録画（off / opt-in / all）
+	RecordDir       string        `json:"record_dir"`         // 録画ファイルの保存先
+	RecordMaxSize   int           `json:"record_max_size"`    // 録画1件の最大サイズ（バイト、0の場合は無制限）
+	RecordRetention time.Duration `json:"record_retention"`   // 録画の保存期間（0の場合は削除しない）
+	SLDuration      time.Duration `json:"sl_duration"`        // slのアニメーションを表示する時間
+	TraceExporter   string        `json:"trace_exporter"`     // トレースの出力先（none / otlp / file）
+	TraceEndpoint   string        `json:"trace_endpoint"`     // OTLP/HTTPの送信先URL（空の場合はOTEL_EXPORTER_OTLP_ENDPOINTなどの標準の環境変数に従う）
+	TraceFile       string        `json:"trace_file"`         // トレースを書き出すファイル（fileの場合）
+	LogLevel        string        `json:"log_level"`          // ログレベル（debug / info / warn / error）
+	LogFormat       string        `json:"log_format"`         // ログ形式（text / json）
+	LogMaxFieldSize int           `json:"log_max_field_size"` // ログの各フィールドの最大サイズ（バイト、超えた分は省略）
+}
+
+// RedisConfig は、Redisの接続設定を表す構造体
+// redis-url を指定した場合、アドレス・ユーザー名・パスワード・DB番号・TLSはURLの値を使用する
+type RedisConfig struct {
+	URL              string   `json:"url"`               // 接続URL（redis:// または rediss://）
+	Mode             string   `json:"mode"`              // 接続モード（standalone / sentinel / cluster）
+	Host             string   `json:"host"`              // Redisサーバのホスト名
+	Port             string   `json:"port"`              // Redisサーバのポート番号
+	Addrs            []string `json:"addrs"`             // Sentinel・Clusterのノードアドレス（空の場合はhost:port）
+	Username         string   `json:"username"`          // ACLユーザー名
+	Password         string   `json:"password"`          // Redisサーバのパスワード
+	PasswordFile     string   `json:"password_file"`     // パスワードを読み込むファイル（Docker secretsなど）
+	DB               int      `json:"db"`                // RedisサーバのDB番号（Clusterでは使用しない）
+	MasterName       string   `json:"master_name"`       // Sentinelで監視しているマスター名
+	SentinelUsername string   `json:"sentinel_username"` // Sentinelに接続するACLユーザー名
+	SentinelPassword string   `json:"sentinel_password"` // Sentinelに接続するパスワード
+	TLS              bool     `json:"tls"`               // TLSで接続するかどうか
+	TLSCAFile        string   `json:"tls_ca_file"`       // サーバー証明書を検証するCA証明書
+	TLSCertFile      string   `json:"tls_cert_file"`     // クライアント証明書
+	TLSKeyFile       string   `json:"tls_key_file"`      // クライアント証明書の秘密鍵
+	TLSServerName    string   `json:"tls_server_name"`   // 証明書の検証に使用するサーバー名
+	CommandChannel   string   `json:"command_channel"`   // コマンド受信用チャンネル
+	ResultChannel    string   `json:"result_channel"`    // 結果送信用チャンネル
+}
+
+// 実行時設定（mainで読み込む）
+var cfg = defaultConfig()
+
+// defaultConfig はデフォルト値の設定を返す
+func defaultConfig() *Config {
+	return &Config{
+		Transport: "redis",
+		Listen:    ":8080",
+		WSPath:    "/ws",
+		Redis: RedisConfig{
+			Mode:           "standalone",
+			Host:           "redis",
+			Port:           "6379",
+			DB:             0,
+			CommandChannel: "terminal:commands",
+			ResultChannel:  "terminal:results",
+		},
+		CommandTimeout:  8 * time.Second, // APIサーバーが結果を待つ時間（10秒）より短くする
+		ShutdownGrace:   10 * time.Second,
+		MaxOutputSize:   10000,
+		MaxSessions:     0,
+		HomeDir:         "/home/nonroot",
+		FSMode:          "host",
+		Locale:          defaultLocale,
+		OverlayStore:    "memory",
+		OverlayTTL:      24 * time.Hour,
+		OverlayMaxFiles: 100,
+		OverlayMaxBytes: 1024 * 1024,
+		ActionOrigins:   []string{"https://github.com"},
+		ImageMaxSize:    512 * 1024,
+		MetricsPath:     "/metrics",
+		Workers:         4,
+		WorkerQueueSize: 16,
+		SessionStore:    "memory",
+		SessionTTL:      24 * time.Hour,
+		HistorySize:     500,
+		RecordMode:      "off",
+		RecordDir:       "recordings",
+		RecordMaxSize:   10 * 1024 * 1024,
+		RecordRetention: 7 * 24 * time.Hour,
+		SLDuration:      3 * time.Second,
+		TraceExporter:   "none",
+		TraceFile:       "traces.jsonl",
+		LogLevel:        "info",
+		LogFormat:       "text",
+		LogMaxFieldSize: 512,
+	}
+}
+
+// configOption は、フラグ・環境変数・設定ファイルで共通の設定項目
+// 設定ファイルのキーはフラグ名と同じ
+type configOption struct {
+	name    string                          // フラグ名（設定ファイルのキー）
+	env     string                          // 環境変数名
+	usage   string                          // フラグの説明
+	set     func(c *Config, v string) error // 文字列の値を設定に反映する関数
+	get     func(c *Config) any             // 設定ファイルに書き出す値を返す関数（setで読み込める形式）
+	boolean bool                            // 値を省略できる真偽値のフラグかどうか
+}
+
+// configOptions は設定可能な項目の一覧
+var configOptions = []configOption{
+	stringOption("transport", "TERMINAL_TRANSPORT", "使用するトランスポート（redis / websocket / stdio）", func(c *Config) *string { return &c.Transport }),
+	stringOption("listen", "TERMINAL_LISTEN", "WebSocketサーバーの待ち受けアドレス", func(c *Config) *string { return &c.Listen }),
+	stringOption("ws-path", "TERMINAL_WS_PATH", "WebSocketエンドポイントのパス", func(c *Config) *string { return &c.WSPath }),
+	listOption("ws-origins", "TERMINAL_WS_ORIGINS", "WebSocket接続を許可するオリジン（カンマ区切り、空の場合は同一オリジンのみ許可）", func(c *Config) *[]string { return &c.WSOrigins }),
+	stringOption("redis-url", "REDIS_URL", "Redisの接続URL（redis:// または rediss://）", func(c *Config) *string { return &c.Redis.URL }),
+	stringOption("redis-mode", "REDIS_MODE", "Redisの接続モード（standalone / sentinel / cluster）", func(c *Config) *string { return &c.Redis.Mode }),
+	stringOption("redis-host", "REDIS_HOST", "Redisサーバのホスト名", func(c *Config) *string { return &c.Redis.Host }),
+	stringOption("redis-port", "REDIS_PORT", "Redisサーバのポート番号", func(c *Config) *string { return &c.Redis.Port }),
+	listOption("redis-addrs", "REDIS_ADDRS", "Sentinel・Clusterのノードアドレス（カンマ区切り）", func(c *Config) *[]string { return &c.Redis.Addrs }),
+	stringOption("redis-username", "REDIS_USERNAME", "RedisのACLユーザー名", func(c *Config) *string { return &c.Redis.Username }),
+	stringOption("redis-password", "REDIS_PASSWORD", "Redisサーバのパスワード", func(c *Config) *string { return &c.Redis.Password }),
+	stringOption("redis-password-file", "REDIS_PASSWORD_FILE", "Redisサーバのパスワードを読み込むファイル", func(c *Config) *string { return &c.Redis.PasswordFile }),
+	intOption("redis-db", "REDIS_DB", "RedisサーバのDB番号", func(c *Config) *int { return &c.Redis.DB }),
+	stringOption("redis-master-name", "REDIS_MASTER_NAME", "Sentinelで監視しているマスター名", func(c *Config) *string { return &c.Redis.MasterName }),
+	stringOption("redis-sentinel-username", "REDIS_SENTINEL_USERNAME", "Sentinelに接続するACLユーザー名", func(c *Config) *string { return &c.Redis.SentinelUsername }),
+	stringOption("redis-sentinel-password", "REDIS_SENTINEL_PASSWORD", "Sentinelに接続するパスワード", func(c *Config) *string { return &c.Redis.SentinelPassword }),
+	boolOption("redis-tls", "REDIS_TLS", "TLSでRedisに接続する", func(c *Config) *bool { return &c.Redis.TLS }),
+	stringOption("redis-tls-ca", "REDIS_TLS_CA", "サーバー証明書を検証するCA証明書のパス", func(c *Config) *string { return &c.Redis.TLSCAFile }),
+	stringOption("redis-tls-cert", "REDIS_TLS_CERT", "クライアント証明書のパス", func(c *Config) *string { return &c.Redis.TLSCertFile }),
+	stringOption("redis-tls-key", "REDIS_TLS_KEY", "クライアント証明書の秘密鍵のパス", func(c *Config) *string { return &c.Redis.TLSKeyFile }),
+	stringOption("redis-tls-server-name", "REDIS_TLS_SERVER_NAME", "証明書の検証に使用するサーバー名", func(c *Config) *string { return &c.Redis.TLSServerName }),
+	stringOption("command-channel", "TERMINAL_COMMAND_CHANNEL", "コマンド受信用チャンネル", func(c *Config) *string { return &c.Redis.CommandChannel }),
+	stringOption("result-channel", "TERMINAL_RESULT_CHANNEL", "結果送信用チャンネル", func(c *Config) *string { return &c.Redis.ResultChannel }),
+	durationOption("command-timeout", "TERMINAL_COMMAND_TIMEOUT", "コマンド実行のタイムアウト（0の場合は無制限）", func(c *Config) *time.Duration { return &c.CommandTimeout }),
+	durationOption("shutdown-grace", "TERMINAL_SHUTDOWN_GRACE", "シャットダウン時に実行中のコマンドの完了を待つ猶予期間", func(c *Config) *time.Duration { return &c.ShutdownGrace }),
+	intOption("max-output-size", "TERMINAL_MAX_OUTPUT_SIZE", "コマンドの実行結果の最大サイズ（バイト）", func(c *Config) *int { return &c.MaxOutputSize }),
+	intOption("max-sessions", "TERMINAL_MAX_SESSIONS", "同時に保持するセッションの最大数（0の場合は無制限）", func(c *Config) *int { return &c.MaxSessions }),
+	stringOption("home-dir", "TERMINAL_HOME_DIR", "セッションの初期ディレクトリ", func(c *Config) *string { return &c.HomeDir }),
+	stringOption("fs-mode", "TERMINAL_FS_MODE", "ファイルシステム（host / virtual: 組み込みのポートフォリオのみを閲覧できる仮想ファイルシステム）", func(c *Config) *string { return &c.FSMode }),
+	stringOption("locale", "TERMINAL_LOCALE", "メッセージのデフォルトの言語（ja / en）", func(c *Config) *string { return &c.Locale }),
+	stringOption("overlay-store", "TERMINAL_OVERLAY_STORE", "仮想ファイルシステムへの書き込みの保存先（off / memory / redis）", func(c *Config) *string { return &c.OverlayStore }),
+	durationOption("overlay-ttl", "TERMINAL_OVERLAY_TTL", "Redisに保存した書き込みの有効期限（0の場合は無期限）", func(c *Config) *time.Duration { return &c.OverlayTTL }),
+	intOption("overlay-max-files", "TERMINAL_OVERLAY_MAX_FILES", "セッションごとに書き込めるファイル数（0の場合は無制限）", func(c *Config) *int { return &c.OverlayMaxFiles }),
+	intOption("overlay-max-bytes", "TERMINAL_OVERLAY_MAX_BYTES", "セッションごとに書き込める容量（バイト、0の場合は無制限）", func(c *Config) *int { return &c.OverlayMaxBytes }),
+	listOption("action-origins", "TERMINAL_ACTION_ORIGINS", "コマンドがフロントエンドに開かせることができるURLのオリジン（カンマ区切り、空の場合はURLを開かない）", func(c *Config) *[]string { return &c.ActionOrigins }),
+	intOption("image-max-size", "TERMINAL_IMAGE_MAX_SIZE", "catで表示する画像の最大サイズ（バイト）", func(c *Config) *int { return &c.ImageMaxSize }),
+	stringOption("policy", "TERMINAL_POLICY", "コマンドポリシーファイルのパス", func(c *Config) *string { return &c.PolicyPath }),
+	stringOption("metrics-listen", "TERMINAL_METRICS_LISTEN", "メトリクスサーバーの待ち受けアドレス（空の場合は無効）", func(c *Config) *string { return &c.MetricsListen }),
+	stringOption("metrics-path", "TERMINAL_METRICS_PATH", "メトリクスエンドポイントのパス", func(c *Config) *string { return &c.MetricsPath }),
+	intOption("workers", "TERMINAL_WORKERS", "コマンドを並行して処理するワーカーの数", func(c *Config) *int { return &c.Workers }),
+	intOption("worker-queue-size", "TERMINAL_WORKER_QUEUE_SIZE", "ワーカーごとの処理待ちキューの長さ", func(c *Config) *int { return &c.WorkerQueueSize }),
+	stringOption("health-listen", "TERMINAL_HEALTH_LISTEN", "ヘルスチェック（/healthz, /readyz）の待ち受けアドレス（空の場合は無効）", func(c *Config) *string { return &c.HealthListen }),
+	stringOption("admin-listen", "TERMINAL_ADMIN_LISTEN", "管理API（/admin/）の待ち受けアドレス（空の場合は無効）", func(c *Config) *string { return &c.AdminListen }),
+	stringOption("admin-token", "TERMINAL_ADMIN_TOKEN", "管理APIの認証トークン", func(c *Config) *string { return &c.AdminToken }),
+	stringOption("admin-token-file", "TERMINAL_ADMIN_TOKEN_FILE", "管理APIの認証トークンを読み込むファイル", func(c *Config) *string { return &c.AdminTokenFile }),
+	stringOption("session-store", "TERMINAL_SESSION_STORE", "セッションの状態の保存先（memory / redis）", func(c *Config) *string { return &c.SessionStore }),
+	durationOption("session-ttl", "TERMINAL_SESSION_TTL", "保存したセッションの状態の有効期限（0の場合は無期限）", func(c *Config) *time.Duration { return &c.SessionTTL }),
+	intOption("history-size", "TERMINAL_HISTORY_SIZE", "セッションごとに保持するコマンド履歴の件数（0の場合は保持しない）", func(c *Config) *int { return &c.HistorySize }),
+	stringOption("record-mode", "TERMINAL_RECORD_MODE", "セッションの録画（off / opt-in / all）", func(c *Config) *string { return &c.RecordMode }),
+	stringOption("record-dir", "TERMINAL_RECORD_DIR", "録画ファイルの保存先", func(c *Config) *string { return &c.RecordDir }),
+	intOption("record-max-size", "TERMINAL_RECORD_MAX_SIZE", "録画1件の最大サイズ（バイト、0の場合は無制限）", func(c *Config) *int { return &c.RecordMaxSize }),
+	durationOption("record-retention", "TERMINAL_RECORD_RETENTION", "録画の保存期間（0の場合は削除しない）", func(c *Config) *time.Duration { return &c.RecordRetention }),
+	durationOption("sl-duration", "TERMINAL_SL_DURATION", "slのアニメーションを表示する時間", func(c *Config) *time.Duration { return &c.SLDuration }),
+	stringOption("trace-exporter", "TERMINAL_TRACE_EXPORTER", "トレースの出力先（none / otlp / file）", func(c *Config) *string { return &c.TraceExporter }),
+	stringOption("trace-endpoint", "TERMINAL_TRACE_ENDPOINT", "OTLP/HTTPの送信先URL（例: http://otel-collector:4318）", func(c *Config) *string { return &c.TraceEndpoint }),
+	stringOption("trace-file", "TERMINAL_TRACE_FILE", "トレースを書き出すファイル（trace-exporterがfileの場合）", func(c *Config) *string { return &c.TraceFile }),
+	stringOption("log-level", "TERMINAL_LOG_LEVEL", "ログレベル（debug / info / warn / error）", func(c *Config) *string { return &c.LogLevel }),
+	stringOption("log-format", "TERMINAL_LOG_FORMAT", "ログ形式（text / json）", func(c *Config) *string { return &c.LogFormat }),
+	intOption("log-max-field-size", "TERMINAL_LOG_MAX_FIELD_SIZE", "ログの各フィールドの最大サイズ（バイト、0の場合は省略しない）", func(c *Config) *int { return &c.LogMaxFieldSize }),
+}
+
+// LoadConfig はデフォルト値・設定ファイル・環境変数・フラグの順に設定を読み込む
+// --print-config が指定された場合は、秘密情報を伏せた設定を出力して終了する
+func LoadConfig(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("terminal", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("TERMINAL_CONFIG"), "設定ファイル（JSON）のパス")
+	printConfig := fs.Bool("print-config", false, "読み込んだ設定を出力して終了する（秘密情報は伏せる）")
+
+	// フラグの値は設定ファイルと環境変数を反映した後に適用するため、一旦保持する
+	var flagSetters []func(c *Config) error
+	defaults := defaultConfig()
+	for _, opt := range configOptions {
+		opt := opt
+		usage := fmt.Sprintf("%s（環境変数: %s）", opt.usage, opt.env)
+		record := func(v string) error {
+			// 値の形式はパース時に検証する
+			if err := opt.set(defaults, v); err != nil {
+				return err
+			}
+			flagSetters = append(flagSetters, func(c *Config) error { return opt.set(c, v) })
+			return nil
+		}
+		if opt.boolean {
+			fs.BoolFunc(opt.name, usage, record)
+		} else {
+			fs.Func(opt.name, usage, record)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	c := defaultConfig()
+
+	// 設定ファイル
+	if *configPath != "" {
+		if err := c.loadFile(*configPath); err != nil {
+			return nil, err
+		}
+	}
+
+	// 環境変数
+	for _, opt := range configOptions {
+		if v, ok := os.LookupEnv(opt.env); ok {
+			if err := opt.set(c, v); err != nil {
+				return nil, fmt.Errorf("環境変数 %s の値が不正です: %w", opt.env, err)
+			}
+		}
+	}
+
+	// フラグ
+	for _, set := range flagSetters {
+		if err := set(c); err != nil {
+			return nil, err
+		}
+	}
+
+	// パスワードファイルが指定されている場合はパスワードを上書き
+	if c.Redis.PasswordFile != "" {
+		data, err := os.ReadFile(c.Redis.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("パスワードファイルの読み込みエラー: %w", err)
+		}
+		c.Redis.Password = strings.TrimSpace(string(data))
+	}
+	// 管理APIのトークンも同様にファイルから読み込める
+	if c.AdminTokenFile != "" {
+		data, err := os.ReadFile(c.AdminTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("トークンファイルの読み込みエラー: %w", err)
+		}
+		c.AdminToken = strings.TrimSpace(string(data))
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	if *printConfig {
+		if err := c.Print(os.Stdout); err != nil {
+			return nil, err
+		}
+		os.Exit(0)
+	}
+	return c, nil
+}
+
+// loadFile はJSON形式の設定ファイルを読み込み、設定に反映する
+// キーはフラグ名と同じ（例: {"redis-host": "localhost", "shutdown-grace": "5s"}）
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("設定ファイルの読み込みエラー: %w", err)
+	}
+
+	// 数値を指数表記に変換しないようjson.Numberとして読み込む
+	var values map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return fmt.Errorf("設定ファイルのパースエラー: %w", err)
+	}
+
+	// 不明なキーは設定ミスの可能性が高いためエラーにする
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		opt, ok := findConfigOption(key)
+		if !ok {
+			return fmt.Errorf("設定ファイルに不明なキーがあります: %s", key)
+		}
+		if err := opt.set(c, configValueString(values[key])); err != nil {
+			return fmt.Errorf("設定ファイルの %s の値が不正です: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// validate は設定値の整合性を確認する
+func (c *Config) validate() error {
+	switch c.Transport {
+	case "redis", "websocket", "stdio":
+	default:
+		return fmt.Errorf("不明なトランスポートです: %s", c.Transport)
+	}
+	switch c.Redis.Mode {
+	case "standalone", "cluster":
+	case "sentinel":
+		if c.Redis.MasterName == "" {
+			return errors.New("sentinelモードでは redis-master-name を指定してください")
+		}
+	default:
+		return fmt.Errorf("不明なRedisの接続モードです: %s", c.Redis.Mode)
+	}
+	if (c.Redis.TLSCertFile == "") != (c.Redis.TLSKeyFile == "") {
+		return errors.New("redis-tls-cert と redis-tls-key は両方指定してください")
+	}
+	if c.AdminListen != "" && c.AdminToken == "" {
+		return errors.New("管理APIを有効にする場合は admin-token を指定してください")
+	}
+	switch c.SessionStore {
+	case "memory", "redis":
+	default:
+		return fmt.Errorf("不明なセッションの保存先です: %s", c.SessionStore)
+	}
+	if c.HistorySize < 0 {
+		return errors.New("history-size は0以上を指定してください")
+	}
+	switch c.RecordMode {
+	case "off", "opt-in", "all":
+	default:
+		return fmt.Errorf("不明な録画モードです: %s", c.RecordMode)
+	}
+	if c.RecordMaxSize < 0 {
+		return errors.New("record-max-size は0以上を指定してください")
+	}
+	if c.SLDuration <= 0 {
+		return errors.New("sl-duration は0より大きい値を指定してください")
+	}
+	switch c.TraceExporter {
+	case "none", "otlp":
+	case "file":
+		if c.TraceFile == "" {
+			return errors.New("trace-exporterがfileの場合は trace-file を指定してください")
+		}
+	default:
+		return fmt.Errorf("不明なトレースの出力先です: %s", c.TraceExporter)
+	}
+	if c.MaxOutputSize <= 0 {
+		return errors.New("max-output-size は1以上を指定してください")
+	}
+	if c.Workers <= 0 || c.WorkerQueueSize <= 0 {
+		return errors.New("workers と worker-queue-size は1以上を指定してください")
+	}
+	if c.MaxSessions < 0 {
+		return errors.New("max-sessions は0以上を指定してください")
+	}
+	if !strings.HasPrefix(c.HomeDir, "/") {
+		return fmt.Errorf("home-dir は絶対パスを指定してください: %s", c.HomeDir)
+	}
+	switch c.FSMode {
+	case "host", "virtual":
+	default:
+		return fmt.Errorf("不明なファイルシステムです: %s", c.FSMode)
+	}
+	if _, ok := catalogs[c.Locale]; !ok {
+		return fmt.Errorf("不明な言語です: %s（%s）", c.Locale, strings.Join(supportedLocales(), " / "))
+	}
+	switch c.OverlayStore {
+	case "off", "memory", "redis":
+	default:
+		return fmt.Errorf("不明な書き込みの保存先です: %s", c.OverlayStore)
+	}
+	if c.OverlayTTL < 0 || c.OverlayMaxFiles < 0 || c.OverlayMaxBytes < 0 {
+		return errors.New("overlay-ttl・overlay-max-files・overlay-max-bytes は0以上を指定してください")
+	}
+	for _, origin := range c.ActionOrigins {
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil || strings.TrimSuffix(u.Path, "/") != "" {
+			return fmt.Errorf("action-origins にはオリジン（例: https://github.com）を指定してください: %s", origin)
+		}
+	}
+	if c.ImageMaxSize <= 0 {
+		return errors.New("image-max-size は1以上を指定してください")
+	}
+	return nil
+}
+
+// secretOptions は、出力時に伏せる設定項目と伏せる関数
+var secretOptions = map[string]func(string) string{
+	"redis-url":               redactURL,
+	"redis-password":          redact,
+	"redis-sentinel-password": redact,
+	"admin-token":             redact,
+}
+
+// Print は秘密情報を伏せた設定をJSONで出力する
+// キーと値の形式は設定ファイルと同じため、伏せた値を書き換えれば設定ファイル（--config）として読み込める
+func (c *Config) Print(w io.Writer) error {
+	var b bytes.Buffer
+	b.WriteString("{\n")
+	for i, opt := range configOptions {
+		value := opt.get(c)
+		if redactValue, ok := secretOptions[opt.name]; ok {
+			value = redactValue(value.(string))
+		}
+		key, err := json.Marshal(opt.name)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "  %s: %s", key, data)
+		if i < len(configOptions)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// redact は秘密情報を伏せた文字列を返す
+// 値が設定されているかどうかだけが分かるようにする
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "********"
+}
+
+// redactURL はURLに含まれるパスワードを伏せた文字列を返す
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		// パースできないURLはパスワードを含む可能性があるためすべて伏せる
+		return redact(rawURL)
+	}
+	return u.Redacted()
+}
+
+// findConfigOption はフラグ名から設定項目を探す
+func findConfigOption(name string) (configOption, bool) {
+	for _, opt := range configOptions {
+		if opt.name == name {
+			return opt, true
+		}
+	}
+	return configOption{}, false
+}
+
+// configValueString は設定ファイルの値を文字列に変換する
+// 配列はカンマ区切りの文字列に変換する
+func configValueString(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []any:
+		items := make([]string, 0, len(val))
+		for _, item := range val {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ",")
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// stringOption は文字列の設定項目を作成する
+func stringOption(name, env, usage string, field func(c *Config) *string) configOption {
+	return configOption{name: name, env: env, usage: usage, set: func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}, get: func(c *Config) any { return *field(c) }}
+}
+
+// intOption は整数の設定項目を作成する
+func intOption(name, env, usage string, field func(c *Config) *int) configOption {
+	return configOption{name: name, env: env, usage: usage, set: func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("整数ではありません: %s", v)
+		}
+		*field(c) = n
+		return nil
+	}, get: func(c *Config) any { return *field(c) }}
+}
+
+// boolOption は真偽値の設定項目を作成する
+// フラグでは値を省略できる（例: -redis-tls）
+func boolOption(name, env, usage string, field func(c *Config) *bool) configOption {
+	return configOption{name: name, env: env, usage: usage, boolean: true, set: func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("真偽値ではありません: %s", v)
+		}
+		*field(c) = b
+		return nil
+	}, get: func(c *Config) any { return *field(c) }}
+}
+
+// durationOption は時間の設定項目を作成する（例: "10s", "1m"）
+func durationOption(name, env, usage string, field func(c *Config) *time.Duration) configOption {
+	return configOption{name: name, env: env, usage: usage, set: func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("時間の形式ではありません: %s", v)
+		}
+		*field(c) = d
+		return nil
+	}, get: func(c *Config) any { return field(c).String() }}
+}
+
+// listOption はカンマ区切りのリストの設定項目を作成する
+func listOption(name, env, usage string, field func(c *Config) *[]string) configOption {
+	return configOption{name: name, env: env, usage: usage, set: func(c *Config, v string) error {
+		var items []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*field(c) = items
+		return nil
+	}, get: func(c *Config) any {
+		// 空のリストはnullではなく[]として出力する
+		if *field(c) == nil {
+			return []string{}
+		}
+		return *field(c)
+	}}
+}
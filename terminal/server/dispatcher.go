@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ディスパッチループの生存確認に関する定数
+const (
+	dispatchHeartbeatInterval = 1 * time.Second  // ディスパッチループが生存を記録する間隔
+	dispatchHeartbeatTimeout  = 30 * time.Second // この時間生存が記録されない場合はループが停止しているとみなす
+	workerWedgeMargin         = 30 * time.Second // コマンドのタイムアウトを超えて処理が続いた場合に停止とみなすまでの余裕
+)
+
+// job は、ワーカーが処理する1件のコマンド
+type job struct {
+	msg     *Message   // 受信したメッセージ（返信に使用）
+	payload *Payload   // パース済みのペイロード
+	span    trace.Span // コマンド1件の処理全体を表すスパン
+}
+
+// stream は実行中の出力を送信元に逐次返信するOutputStreamを返す
+func (j job) stream(replyCtx context.Context) OutputStream {
+	return func(output string) error {
+		return j.msg.Reply(replyCtx, &CommandResult{
+			Status:    "output",
+			Command:   j.payload.Command,
+			Result:    output,
+			SessionID: j.payload.SessionID,
+			RequestID: j.payload.RequestID,
+		})
+	}
+}
+
+// worker は、1つのワーカーの状態を表す構造体
+type worker struct {
+	queue     chan job     // 処理待ちのコマンド
+	busySince atomic.Int64 // 処理を開始した時刻（UnixNano、待機中は0）
+}
+
+// Dispatcher は、受信したコマンドをワーカープールに振り分ける構造体
+// 同じセッションのコマンドは常に同じワーカーで処理されるため、セッション内の実行順序は保たれる
+type Dispatcher struct {
+	workers   []*worker
+	handle    func(ctx context.Context, payload *Payload) *CommandResult // コマンドの処理関数
+	stopping  atomic.Bool                                                // キューに残ったコマンドを破棄するかどうか（シャットダウン中）
+	lastBeat  atomic.Int64                                               // ディスパッチループが最後に生存を記録した時刻（UnixNano）
+	blockedAt atomic.Int64                                               // キューが満杯で振り分けを待ち始めた時刻（UnixNano、待機していない場合は0）
+	wg        sync.WaitGroup                                             // ワーカーの終了待ち
+}
+
+// NewDispatcher は新しいDispatcherを作成
+func NewDispatcher(workers, queueSize int, handle func(ctx context.Context, payload *Payload) *CommandResult) *Dispatcher {
+	d := &Dispatcher{handle: handle}
+	for i := 0; i < workers; i++ {
+		d.workers = append(d.workers, &worker{queue: make(chan job, queueSize)})
+	}
+	d.Beat()
+	return d
+}
+
+// Start はワーカーを起動する
+// execCtxはコマンドの実行に、replyCtxは結果の送信に使用する
+func (d *Dispatcher) Start(execCtx, replyCtx context.Context) {
+	for i, w := range d.workers {
+		d.wg.Add(1)
+		go d.run(execCtx, replyCtx, i, w)
+	}
+}
+
+// run はワーカーのキューからコマンドを取り出して処理する
+func (d *Dispatcher) run(execCtx, replyCtx context.Context, index int, w *worker) {
+	defer d.wg.Done()
+
+	for j := range w.queue {
+		j.span.AddEvent("dequeued", trace.WithAttributes(attribute.Int(traceAttr("worker"), index)))
+
+		var result *CommandResult
+		if d.stopping.Load() {
+			// シャットダウン開始後はキューに残ったコマンドを実行しない
+			result = &CommandResult{
+				Command:   j.payload.Command,
+				SessionID: j.payload.SessionID,
+				RequestID: j.payload.RequestID,
+			}
+			result.setError(resolveLocale(j.payload), newMessageError("error.shutting_down"))
+		} else {
+			ctx := trace.ContextWithSpan(execCtx, j.span)
+			if j.msg.Streaming {
+				ctx = withOutputStream(ctx, j.stream(replyCtx))
+			}
+			w.busySince.Store(time.Now().UnixNano())
+			result = d.safeHandle(ctx, j.payload)
+			w.busySince.Store(0)
+		}
+
+		// 結果を送信元に返す
+		ctx, span := tracer.Start(trace.ContextWithSpan(replyCtx, j.span), "publish")
+		if err := j.msg.Reply(ctx, result); err != nil {
+			slog.Error("結果のパブリッシュエラー", "error", err, "session_id", result.SessionID, "request_id", result.RequestID)
+			recordSpanError(span, err)
+		}
+		span.End()
+		endRequestSpan(j.span, result)
+	}
+}
+
+// safeHandle はコマンドを処理し、結果を返す
+// 処理中にpanicした場合はサーバー全体を停止させず、エラーの結果を返す
+func (d *Dispatcher) safeHandle(ctx context.Context, payload *Payload) (result *CommandResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("コマンドの処理中にpanicしました", "panic", r, "stack", string(debug.Stack()),
+				"session_id", payload.SessionID, "request_id", payload.RequestID)
+			commandsFailed.WithLabelValues(reasonPanic).Inc()
+			result = &CommandResult{
+				Command:   payload.Command,
+				SessionID: payload.SessionID,
+				RequestID: payload.RequestID,
+			}
+			result.setError(resolveLocale(payload), newMessageError("error.execute", fmt.Errorf("panic: %v", r)))
+		}
+	}()
+	return d.handle(ctx, payload)
+}
+
+// Dispatch はセッションIDに対応するワーカーにコマンドを振り分ける
+// キューが満杯の場合は空きができるまで待機し、ctxがキャンセルされた場合はエラーを返す
+// spanはワーカーが処理を終えた時点で終了する
+func (d *Dispatcher) Dispatch(ctx context.Context, msg *Message, payload *Payload, span trace.Span) error {
+	w := d.workers[d.shard(payload.SessionID)]
+	j := job{msg: msg, payload: payload, span: span}
+
+	select {
+	case w.queue <- j:
+		return nil
+	default:
+	}
+
+	// キューが満杯の間も生存を記録し、飽和状態として公開する
+	d.blockedAt.Store(time.Now().UnixNano())
+	defer d.blockedAt.Store(0)
+	slog.Warn("ワーカーのキューが満杯のため待機します", "session_id", payload.SessionID, "request_id", payload.RequestID)
+
+	ticker := time.NewTicker(dispatchHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case w.queue <- j:
+			return nil
+		case <-ticker.C:
+			d.Beat()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// shard はセッションIDからワーカーの番号を求める
+func (d *Dispatcher) shard(sessionID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(sessionID))
+	return int(h.Sum32() % uint32(len(d.workers)))
+}
+
+// Beat はディスパッチループの生存を記録する
+func (d *Dispatcher) Beat() {
+	d.lastBeat.Store(time.Now().UnixNano())
+}
+
+// Stop は新しいコマンドの受け付けを停止し、ワーカーの終了を待つ
+// 実行中のコマンドは完了まで待つ
+// discardがtrueの場合、キューに残ったコマンドは実行せずにエラーを返す
+func (d *Dispatcher) Stop(discard bool) {
+	d.stopping.Store(discard)
+	for _, w := range d.workers {
+		close(w.queue)
+	}
+	d.wg.Wait()
+}
+
+// Alive はディスパッチループとワーカーが停止していないかを確認する
+func (d *Dispatcher) Alive() error {
+	now := time.Now()
+	if since := now.Sub(time.Unix(0, d.lastBeat.Load())); since > dispatchHeartbeatTimeout {
+		return fmt.Errorf("ディスパッチループが %v 応答していません", since.Round(time.Second))
+	}
+
+	// タイムアウトが無制限の場合は実行時間で判断できない
+	if cfg.CommandTimeout <= 0 {
+		return nil
+	}
+	limit := cfg.CommandTimeout + workerWedgeMargin
+	for i, w := range d.workers {
+		busySince := w.busySince.Load()
+		if busySince == 0 {
+			continue
+		}
+		if busy := now.Sub(time.Unix(0, busySince)); busy > limit {
+			return fmt.Errorf("ワーカー%dが %v 同じコマンドを処理しています", i, busy.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// Saturated はワーカーのキューが満杯で、コマンドの振り分けが待たされているかどうかを返す
+func (d *Dispatcher) Saturated() error {
+	if d.stopping.Load() {
+		return errors.New("シャットダウン中です")
+	}
+	if blockedAt := d.blockedAt.Load(); blockedAt != 0 {
+		return fmt.Errorf("ワーカーのキューが満杯です（%v待機中）", time.Since(time.Unix(0, blockedAt)).Round(time.Millisecond))
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// ErrorCode は、エラーの種類を表す機械可読なコード
+// クライアントはメッセージ（言語によって変わる）ではなく、このコードでエラーの種類を判別する
+type ErrorCode string
+
+const (
+	ErrorPolicyDenied     ErrorCode = "POLICY_DENIED"      // ポリシーで許可されていないコマンド
+	ErrorEmptyCommand     ErrorCode = "EMPTY_COMMAND"      // 空のコマンド
+	ErrorProtocol         ErrorCode = "PROTOCOL_ERROR"     // 不正なメッセージ（不明な種類・セッションIDなし）
+	ErrorOutputTooLarge   ErrorCode = "OUTPUT_TOO_LARGE"   // 実行結果が上限を超えた
+	ErrorInvalidOutput    ErrorCode = "INVALID_OUTPUT"     // 実行結果に不正な文字列が含まれる
+	ErrorTimeout          ErrorCode = "TIMEOUT"            // コマンドがタイムアウトした
+	ErrorInterrupted      ErrorCode = "INTERRUPTED"        // クライアントから中断された
+	ErrorSessionKilled    ErrorCode = "SESSION_KILLED"     // 管理APIからセッションが終了された
+	ErrorShuttingDown     ErrorCode = "SHUTTING_DOWN"      // サーバーのシャットダウンにより中断された
+	ErrorExitStatus       ErrorCode = "EXIT_STATUS"        // コマンドが0以外の終了コードで終了した
+	ErrorSessionLimit     ErrorCode = "SESSION_LIMIT"      // セッション数が上限に達している
+	ErrorSession          ErrorCode = "SESSION_ERROR"      // セッションを作成・取得できない
+	ErrorSessionInUse     ErrorCode = "SESSION_IN_USE"     // セッションが他のWebSocket接続で使用されている
+	ErrorSyntax           ErrorCode = "SYNTAX_ERROR"       // コマンドラインの構文エラー
+	ErrorCommandNotFound  ErrorCode = "COMMAND_NOT_FOUND"  // コマンドが見つからない
+	ErrorHistoryNotFound  ErrorCode = "HISTORY_NOT_FOUND"  // 参照した履歴が見つからない
+	ErrorInvalidArgument  ErrorCode = "INVALID_ARGUMENT"   // 無効なオプション・引数
+	ErrorNotFound         ErrorCode = "NOT_FOUND"          // ファイル・ディレクトリが存在しない
+	ErrorPermissionDenied ErrorCode = "PERMISSION_DENIED"  // ファイル・ディレクトリへのアクセスが許可されていない
+	ErrorNotADirectory    ErrorCode = "NOT_A_DIRECTORY"    // ディレクトリではない
+	ErrorIsADirectory     ErrorCode = "IS_A_DIRECTORY"     // ディレクトリである
+	ErrorReadOnly         ErrorCode = "READ_ONLY"          // 書き込めないファイルシステム
+	ErrorAlreadyExists    ErrorCode = "ALREADY_EXISTS"     // ファイルが既に存在する
+	ErrorQuotaExceeded    ErrorCode = "QUOTA_EXCEEDED"     // セッションの書き込みの上限を超えた
+	ErrorMaintenance      ErrorCode = "MAINTENANCE"        // メンテナンス中
+	ErrorActionDenied     ErrorCode = "ACTION_DENIED"      // 許可されていないフロントエンドの操作（URL・画像）
+	ErrorNoRunningCommand ErrorCode = "NO_RUNNING_COMMAND" // 中断するコマンドが実行中でない
+	ErrorInternal         ErrorCode = "INTERNAL_ERROR"     // サーバー内部のエラー
+	ErrorCommandFailed    ErrorCode = "COMMAND_FAILED"     // その他のコマンドのエラー
+)
+
+// messageErrorCodes は、メッセージIDに対応するエラーコード
+// 原因のエラー（引数に含めたエラー）がコードを持つ場合は、原因のコードを優先する
+var messageErrorCodes = map[string]ErrorCode{
+	"error.timeout":              ErrorTimeout,
+	"error.killed":               ErrorSessionKilled,
+	"error.interrupted":          ErrorInterrupted,
+	"error.canceled":             ErrorShuttingDown,
+	"error.shutting_down":        ErrorShuttingDown,
+	"error.exit_status":          ErrorExitStatus,
+	"error.session":              ErrorSession,
+	"error.session_limit":        ErrorSessionLimit,
+	"error.session_in_use":       ErrorSessionInUse,
+	"error.syntax":               ErrorSyntax,
+	"error.shell_operator":       ErrorSyntax,
+	"error.execute":              ErrorInternal,
+	"error.command_not_found":    ErrorCommandNotFound,
+	"error.unknown_message_type": ErrorProtocol,
+	"error.no_running_command":   ErrorNoRunningCommand,
+	"error.maintenance":          ErrorMaintenance,
+	"error.maintenance_default":  ErrorMaintenance,
+	"builtin.usage":              ErrorInvalidArgument,
+	"builtin.invalid_option":     ErrorInvalidArgument,
+	"parse.unterminated_quote":   ErrorSyntax,
+	"redirect.target_required":   ErrorSyntax,
+	"validate.empty_command":     ErrorEmptyCommand,
+	"validate.denied":            ErrorPolicyDenied,
+	"validate.empty_session":     ErrorProtocol,
+	"validate.output_too_large":  ErrorOutputTooLarge,
+	"validate.invalid_output":    ErrorInvalidOutput,
+	"history.empty":              ErrorHistoryNotFound,
+	"history.not_found":          ErrorHistoryNotFound,
+	"history.invalid_count":      ErrorInvalidArgument,
+	"help.error.invalid_option":  ErrorInvalidArgument,
+	"help.error.usage":           ErrorInvalidArgument,
+	"help.error.not_found":       ErrorCommandNotFound,
+	"cd.not_found":               ErrorNotFound,
+	"cd.not_a_directory":         ErrorNotADirectory,
+	"cd.permission_denied":       ErrorPermissionDenied,
+	"cd.no_previous":             ErrorNotFound,
+	"cd.no_home":                 ErrorNotFound,
+	"export.invalid_name":        ErrorInvalidArgument,
+	"export.protected":           ErrorPolicyDenied,
+	"alias.not_found":            ErrorNotFound,
+	"alias.invalid_name":         ErrorInvalidArgument,
+	"unalias.not_found":          ErrorNotFound,
+	"tree.depth_required":        ErrorInvalidArgument,
+	"tree.invalid_depth":         ErrorInvalidArgument,
+	"action.denied":              ErrorActionDenied,
+	"action.image_too_large":     ErrorOutputTooLarge,
+	"open.not_found":             ErrorNotFound,
+}
+
+// errorParam は、エラーメッセージの引数に名前を付けたもの
+// メッセージの書式では値として展開し、結果の構造化パラメータ（error_params）にも含める
+type errorParam struct {
+	name  string
+	value any
+}
+
+// param は名前付きのエラーメッセージの引数を作成
+func param(name string, value any) errorParam {
+	return errorParam{name: name, value: value}
+}
+
+// errorCode はエラーのコードを返す
+// 原因のエラー、メッセージID、ファイルシステムのエラーの順に求め、いずれもない場合はCOMMAND_FAILEDを返す
+func errorCode(err error) ErrorCode {
+	if code := findErrorCode(err); code != "" {
+		return code
+	}
+	return ErrorCommandFailed
+}
+
+// findErrorCode はエラーのコードを求める。見つからない場合は空文字列を返す
+func findErrorCode(err error) ErrorCode {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			if code := findErrorCode(e); code != "" {
+				return code
+			}
+		}
+		return ""
+	}
+
+	var msgErr *messageError
+	if errors.As(err, &msgErr) {
+		for _, arg := range msgErr.args {
+			if cause, ok := arg.(error); ok {
+				if code := findErrorCode(cause); code != "" {
+					return code
+				}
+			}
+		}
+		return messageErrorCodes[msgErr.id]
+	}
+	return fsErrorCode(err)
+}
+
+// fsErrorCode はファイルシステムのエラーのコードを返す
+// ファイルシステムのエラーでない場合は空文字列を返す
+func fsErrorCode(err error) ErrorCode {
+	var quota *quotaError
+	switch {
+	case errors.As(err, &quota):
+		return ErrorQuotaExceeded
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrorNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return ErrorPermissionDenied
+	case errors.Is(err, errIsDir):
+		return ErrorIsADirectory
+	case errors.Is(err, errNotDir):
+		return ErrorNotADirectory
+	case errors.Is(err, errReadOnly):
+		return ErrorReadOnly
+	case errors.Is(err, errExist):
+		return ErrorAlreadyExists
+	default:
+		return ""
+	}
+}
+
+// errorParams はエラーの名前付きの引数を返す（原因のエラーの引数を含む）
+// 名前付きの引数がない場合はnilを返す
+func errorParams(err error) map[string]any {
+	params := make(map[string]any)
+	collectErrorParams(err, params)
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
+
+// collectErrorParams はエラーの名前付きの引数をparamsに追加する
+// 同じ名前の引数は、外側のエラーの値を優先する
+// 複数のエラーをまとめたエラーは、コードと同じく最初のエラーの引数を使用する
+func collectErrorParams(err error, params map[string]any) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		if errs := joined.Unwrap(); len(errs) > 0 {
+			collectErrorParams(errs[0], params)
+		}
+		return
+	}
+
+	// 原因のエラーの引数を先に追加し、外側のエラーの引数で上書きする
+	var msgErr *messageError
+	if errors.As(err, &msgErr) {
+		for _, arg := range msgErr.args {
+			if cause, ok := arg.(error); ok {
+				collectErrorParams(cause, params)
+			}
+		}
+		for _, arg := range msgErr.args {
+			if p, ok := arg.(errorParam); ok {
+				params[p.name] = p.value
+			}
+		}
+		return
+	}
+
+	var quota *quotaError
+	if errors.As(err, &quota) {
+		params["kind"] = quota.kind
+		params["limit"] = quota.limit
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		params["path"] = pathErr.Path
+	}
+}
+
+// setError はエラーを、言語に応じたメッセージ・エラーコード・パラメータとして結果に設定する
+func (r *CommandResult) setError(locale string, err error) {
+	r.Status = "error"
+	r.Error = localizeError(locale, err)
+	r.ErrorCode = errorCode(err)
+	r.ErrorParams = errorParams(err)
+}
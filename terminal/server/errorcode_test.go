@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"testing"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		want   ErrorCode
+		params map[string]any
+	}{
+		{
+			name: "plain error",
+			err:  errors.New("x"),
+			want: ErrorCommandFailed,
+		},
+		{
+			name:   "usage",
+			err:    newMessageError("builtin.usage", param("command", "rm"), param("usage", "rm [-r] [-f] file ...")),
+			want:   ErrorInvalidArgument,
+			params: map[string]any{"command": "rm", "usage": "rm [-r] [-f] file ..."},
+		},
+		{
+			name:   "invalid option",
+			err:    newMessageError("builtin.invalid_option", param("command", "ls"), param("option", "-z")),
+			want:   ErrorInvalidArgument,
+			params: map[string]any{"command": "ls", "option": "-z"},
+		},
+		{
+			name:   "invalid depth",
+			err:    newMessageError("tree.invalid_depth", param("depth", "0")),
+			want:   ErrorInvalidArgument,
+			params: map[string]any{"depth": "0"},
+		},
+		{
+			name:   "cause code wins",
+			err:    newMessageError("error.command", param("command", "echo"), newMessageError("parse.unterminated_quote")),
+			want:   ErrorSyntax,
+			params: map[string]any{"command": "echo"},
+		},
+		{
+			name:   "exit status",
+			err:    newMessageError("error.exit_status", param("exit_code", 2)),
+			want:   ErrorExitStatus,
+			params: map[string]any{"exit_code": 2},
+		},
+		{
+			name: "shutting down",
+			err:  newMessageError("error.shutting_down"),
+			want: ErrorShuttingDown,
+		},
+		{
+			name:   "file system error",
+			err:    newMessageError("fs.error", param("command", "cat"), param("path", "x"), &fs.PathError{Op: "open", Path: "/x", Err: fs.ErrNotExist}),
+			want:   ErrorNotFound,
+			params: map[string]any{"command": "cat", "path": "x"},
+		},
+		{
+			name:   "joined errors use the first",
+			err:    errors.Join(newMessageError("alias.not_found", param("name", "a")), errors.New("x")),
+			want:   ErrorNotFound,
+			params: map[string]any{"name": "a"},
+		},
+		{
+			name: "wrapped",
+			err:  fmt.Errorf("sl: %w", errInterrupted),
+			want: ErrorInterrupted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorCode(tt.err); got != tt.want {
+				t.Errorf("errorCode() = %s, want %s", got, tt.want)
+			}
+			if got := errorParams(tt.err); !maps.Equal(got, tt.params) {
+				t.Errorf("errorParams() = %v, want %v", got, tt.params)
+			}
+		})
+	}
+}
+
+func TestSetErrorMessage(t *testing.T) {
+	var result CommandResult
+	result.setError("en", newMessageError("error.exit_status", param("exit_code", 1)))
+	if want := "Command exited with status 1"; result.Error != want {
+		t.Errorf("Error = %q, want %q", result.Error, want)
+	}
+	if result.Status != "error" || result.ErrorCode != ErrorExitStatus {
+		t.Errorf("Status, ErrorCode = %q, %q, want error, %s", result.Status, result.ErrorCode, ErrorExitStatus)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// ヘルスチェックに関する定数
+const (
+	shellCheckTimeout  = 5 * time.Second  // シェル起動確認のタイムアウト
+	shellCheckCacheTTL = 10 * time.Second // シェル起動確認の結果を再利用する期間
+)
+
+// readinessChecker は、トランスポートがコマンドを受信できる状態かを報告するインターフェース
+// 実装していないトランスポートは常に準備完了とみなす
+type readinessChecker interface {
+	Ready() error
+}
+
+// healthCheck は、1つのヘルスチェック項目
+type healthCheck struct {
+	name  string       // 項目名
+	check func() error // 確認処理（問題がなければnil）
+}
+
+// healthResponse は、ヘルスチェックのレスポンス
+type healthResponse struct {
+	Status string            `json:"status"` // 全体の状態（ok / unavailable）
+	Checks map[string]string `json:"checks"` // 項目ごとの状態（ok またはエラーメッセージ）
+}
+
+// newHealthHandler はチェック項目をすべて実行し、結果をJSONで返すハンドラーを作成する
+// いずれかの項目が失敗した場合は503を返す
+func newHealthHandler(checks []healthCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := healthResponse{Status: "ok", Checks: make(map[string]string)}
+		for _, c := range checks {
+			if err := c.check(); err != nil {
+				resp.Status = "unavailable"
+				resp.Checks[c.name] = err.Error()
+			} else {
+				resp.Checks[c.name] = "ok"
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if resp.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			slog.Warn("ヘルスチェックのレスポンス送信エラー", "error", err)
+		}
+	}
+}
+
+// livenessChecks は生存確認（/healthz）の項目を返す
+// ディスパッチループやワーカーが停止している場合は再起動が必要
+func livenessChecks(d *Dispatcher) []healthCheck {
+	return []healthCheck{
+		{name: "dispatcher", check: d.Alive},
+	}
+}
+
+// readinessChecks は準備完了確認（/readyz）の項目を返す
+func readinessChecks(d *Dispatcher, transport Transport) []healthCheck {
+	checks := []healthCheck{
+		{name: "workers", check: d.Saturated},
+		{name: "shell", check: shellChecker.Check},
+	}
+	if rc, ok := transport.(readinessChecker); ok {
+		checks = append(checks, healthCheck{name: "transport", check: rc.Ready})
+	}
+	return checks
+}
+
+// shellCheck は、セッションのシェルを起動できるかを確認する構造体
+// プローブのたびにプロセスを起動しないよう、結果を一定期間再利用する
+type shellCheck struct {
+	checkedAt time.Time  // 最後に確認した時刻
+	err       error      // 最後の確認結果
+	mu        sync.Mutex // 排他制御用ミューテックス
+}
+
+// シェル起動確認のインスタンス
+var shellChecker = &shellCheck{}
+
+// Check はシェルを起動できるかを確認する
+func (s *shellCheck) Check() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.checkedAt) < shellCheckCacheTTL {
+		return s.err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shellCheckTimeout)
+	defer cancel()
+	if err := exec.CommandContext(ctx, "bash", "-c", ":").Run(); err != nil {
+		s.err = errors.New("シェルを起動できません: " + err.Error())
+	} else {
+		s.err = nil
+	}
+	s.checkedAt = time.Now()
+	return s.err
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+func init() {
+	builtins.Register(helpBuiltin{})
+
+	// イメージに含まれる外部コマンドの説明
+	// 実行できない（PATH上に存在しない・ポリシーで拒否されている）コマンドはhelpに表示しない
+	registerCommandDoc(CommandDoc{
+		Name:     "ls",
+		Usage:    "ls [オプション] [ファイル ...]",
+		Summary:  "ディレクトリの内容を一覧表示します",
+		Examples: []string{"ls", "ls -la", "ls /home/nonroot"},
+		Options: []CommandOption{
+			{Flag: "-a", Description: "隠しファイルも表示します"},
+			{Flag: "-l", Description: "詳細な情報を表示します"},
+			{Flag: "-h", Description: "サイズを読みやすい単位で表示します（-lと併用）"},
+		},
+	})
+	registerCommandDoc(CommandDoc{
+		Name:     "cat",
+		Usage:    "cat [オプション] ファイル ...",
+		Summary:  "ファイルの内容を表示します",
+		Examples: []string{"cat introduction"},
+		Options: []CommandOption{
+			{Flag: "-n", Description: "行番号を付けて表示します"},
+		},
+	})
+	registerCommandDoc(CommandDoc{
+		Name:     "profile",
+		Usage:    "profile [--about] [--skills] [--works] [--career] [--contact] [--json]",
+		Summary:  "プロフィールを表示します",
+		Examples: []string{"profile", "profile --skills", "profile --works --contact", "profile --json"},
+		Options: []CommandOption{
+			{Flag: "--about", Description: "自己紹介を表示します"},
+			{Flag: "--skills", Description: "スキルを表示します"},
+			{Flag: "--works", Description: "制作物を表示します"},
+			{Flag: "--career", Description: "経歴を表示します"},
+			{Flag: "--contact", Description: "連絡先を表示します"},
+			{Flag: "--json", Description: "JSON形式で出力します"},
+			{Flag: "--width N", Description: "N桁で折り返します（省略時は COLUMNS 環境変数）"},
+			{Flag: "--no-color", Description: "色を付けずに出力します"},
+		},
+	})
+	registerCommandDoc(CommandDoc{
+		Name:     "whoami",
+		Usage:    "whoami",
+		Summary:  "現在のユーザー名を表示します",
+		Examples: []string{"whoami"},
+	})
+}
+
+// CommandOption は、コマンドのオプション1件の説明
+type CommandOption struct {
+	Flag        string `json:"flag"`        // オプション（例: "-l"）
+	Description string `json:"description"` // オプションの説明
+}
+
+// CommandDoc は、helpで表示するコマンドの説明
+type CommandDoc struct {
+	Name     string          `json:"name"`               // コマンド名
+	Usage    string          `json:"usage"`              // 使い方
+	Summary  string          `json:"summary"`            // コマンドの説明
+	Examples []string        `json:"examples,omitempty"` // 使用例
+	Options  []CommandOption `json:"options,omitempty"`  // オプション
+	Builtin  bool            `json:"builtin"`            // ビルトインコマンドかどうか
+}
+
+// builtinDetail は、helpで使用例とオプションを表示するビルトインコマンドが実装するインターフェース
+type builtinDetail interface {
+	// Examples は使用例を返す
+	Examples() []string
+	// Options はオプションの説明を返す
+	Options() []CommandOption
+}
+
+// 外部コマンド（bashで実行するコマンド）の説明
+// コマンド名をキーとし、各ファイルのinitで登録する
+var commandDocs = make(map[string]CommandDoc)
+
+// registerCommandDoc は外部コマンドの説明を登録する
+// 同じ名前の説明を二重に登録した場合はpanicする
+func registerCommandDoc(doc CommandDoc) {
+	if _, exists := commandDocs[doc.Name]; exists {
+		panic(fmt.Sprintf("コマンドの説明が二重に登録されています: %s", doc.Name))
+	}
+	commandDocs[doc.Name] = doc
+}
+
+// builtinDoc はビルトインコマンドの説明を返す
+func builtinDoc(b Builtin) CommandDoc {
+	doc := CommandDoc{
+		Name:    b.Name(),
+		Usage:   b.Usage(),
+		Summary: b.Help(),
+		Builtin: true,
+	}
+	if d, ok := b.(builtinDetail); ok {
+		doc.Examples = d.Examples()
+		doc.Options = d.Options()
+	}
+	return doc
+}
+
+// localizeDoc はコマンドの説明・使い方・オプションの説明を言語に応じて翻訳する
+// 翻訳がない項目は登録された説明（デフォルトの言語）のまま返す
+func localizeDoc(doc CommandDoc, locale string) CommandDoc {
+	prefix := "help." + doc.Name + "."
+	doc.Summary = translateOr(locale, prefix+"summary", doc.Summary)
+	doc.Usage = translateOr(locale, prefix+"usage", doc.Usage)
+	if len(doc.Options) > 0 {
+		options := make([]CommandOption, len(doc.Options))
+		for i, opt := range doc.Options {
+			opt.Description = translateOr(locale, prefix+"option."+opt.Flag, opt.Description)
+			options[i] = opt
+		}
+		doc.Options = options
+	}
+	return doc
+}
+
+// lookupCommandDoc は実行できるコマンドの説明を、言語に応じて翻訳して返す
+// ポリシーで拒否されているコマンドと、存在しない（仮想ファイルシステムモードではすべての）外部コマンドは見つからないものとして扱う
+func lookupCommandDoc(name, locale string) (CommandDoc, bool) {
+	if !policy.Allows(name) {
+		return CommandDoc{}, false
+	}
+	if b, ok := builtins.Lookup(name); ok {
+		return localizeDoc(builtinDoc(b), locale), true
+	}
+	// 仮想ファイルシステムモードでは外部コマンドを実行できない
+	doc, ok := commandDocs[name]
+	if !ok || virtualFS() {
+		return CommandDoc{}, false
+	}
+	if _, err := exec.LookPath(name); err != nil {
+		return CommandDoc{}, false
+	}
+	return localizeDoc(doc, locale), true
+}
+
+// availableCommandDocs は実行できるコマンドの説明を名前順に返す
+func availableCommandDocs(locale string) []CommandDoc {
+	var docs []CommandDoc
+	for _, b := range builtins.All() {
+		if doc, ok := lookupCommandDoc(b.Name(), locale); ok {
+			docs = append(docs, doc)
+		}
+	}
+	for name := range commandDocs {
+		// ビルトインコマンドと同じ名前の外部コマンドは、ビルトインコマンドが優先して実行される
+		if _, isBuiltin := builtins.Lookup(name); isBuiltin {
+			continue
+		}
+		if doc, ok := lookupCommandDoc(name, locale); ok {
+			docs = append(docs, doc)
+		}
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].Name < docs[j].Name
+	})
+	return docs
+}
+
+// helpBuiltin は実行できるコマンドの一覧と使い方を表示するコマンド
+type helpBuiltin struct{}
+
+func (helpBuiltin) Name() string               { return "help" }
+func (helpBuiltin) Usage() string              { return "help [--json] [コマンド]" }
+func (helpBuiltin) Help() string               { return "コマンドの一覧と使い方を表示します" }
+func (helpBuiltin) Completion() completionKind { return completeCommands }
+
+func (helpBuiltin) Examples() []string {
+	return []string{"help", "help cd", "help --json ls"}
+}
+
+func (helpBuiltin) Options() []CommandOption {
+	return []CommandOption{
+		{Flag: "--json", Description: "JSON形式で出力します"},
+	}
+}
+
+// Run は引数なしでコマンドの一覧を、コマンドを指定するとそのコマンドの詳細を表示する
+// 説明はセッションの言語で表示する
+func (helpBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	locale := localeFrom(ctx)
+	asJSON := false
+	var names []string
+	for _, arg := range args {
+		switch {
+		case arg == "--json":
+			asJSON = true
+		case strings.HasPrefix(arg, "-"):
+			return "", newMessageError("help.error.invalid_option", param("option", arg))
+		default:
+			names = append(names, arg)
+		}
+	}
+	if len(names) > 1 {
+		return "", newMessageError("help.error.usage", param("usage", translateOr(locale, "help.help.usage", helpBuiltin{}.Usage())))
+	}
+
+	if len(names) == 0 {
+		docs := availableCommandDocs(locale)
+		if asJSON {
+			return marshalHelp(docs)
+		}
+		return formatHelpList(docs, locale), nil
+	}
+
+	doc, ok := lookupCommandDoc(names[0], locale)
+	if !ok {
+		return "", newMessageError("help.error.not_found", param("command", names[0]))
+	}
+	if asJSON {
+		return marshalHelp(doc)
+	}
+	return formatHelpDetail(doc, locale), nil
+}
+
+// marshalHelp はhelpの出力をJSONに変換する
+func marshalHelp(v any) (string, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// formatHelpList はコマンドの一覧を表示用に整形する
+func formatHelpList(docs []CommandDoc, locale string) string {
+	width := 0
+	for _, doc := range docs {
+		width = max(width, len(doc.Name))
+	}
+
+	var b strings.Builder
+	b.WriteString(translate(locale, "help.list.header") + "\n")
+	for _, doc := range docs {
+		fmt.Fprintf(&b, "  %-*s  %s\n", width, doc.Name, doc.Summary)
+	}
+	b.WriteString("\n" + translate(locale, "help.list.footer"))
+	return b.String()
+}
+
+// formatHelpDetail はコマンドの詳細を表示用に整形する
+func formatHelpDetail(doc CommandDoc, locale string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s - %s\n\n%s\n  %s\n", doc.Name, doc.Summary, translate(locale, "help.detail.usage"), doc.Usage)
+
+	if len(doc.Options) > 0 {
+		width := 0
+		for _, opt := range doc.Options {
+			width = max(width, len(opt.Flag))
+		}
+		b.WriteString("\n" + translate(locale, "help.detail.options") + "\n")
+		for _, opt := range doc.Options {
+			fmt.Fprintf(&b, "  %-*s  %s\n", width, opt.Flag, opt.Description)
+		}
+	}
+	if len(doc.Examples) > 0 {
+		b.WriteString("\n" + translate(locale, "help.detail.examples") + "\n")
+		for _, example := range doc.Examples {
+			fmt.Fprintf(&b, "  %s\n", example)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
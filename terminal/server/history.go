@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 履歴を参照するコマンド（!!、!n、!-n）
+// 続けて引数を指定した場合は、参照したコマンドの後ろに追加する（例: !! --help）
+var historyRefPattern = regexp.MustCompile(`^!(!|-?[0-9]+)(\s.*)?$`)
+
+// trimHistory は保持する件数を超えた古い履歴を削除する
+func trimHistory(history []HistoryEntry) []HistoryEntry {
+	if len(history) <= cfg.HistorySize {
+		return history
+	}
+	return append([]HistoryEntry(nil), history[len(history)-cfg.HistorySize:]...)
+}
+
+// expandHistory は履歴を参照するコマンドを、参照先のコマンドに展開する
+// 履歴を参照していない場合はそのまま返す
+func expandHistory(ctx context.Context, cmd, sessionID string) (string, error) {
+	m := historyRefPattern.FindStringSubmatch(strings.TrimSpace(cmd))
+	if m == nil {
+		return cmd, nil
+	}
+
+	session, err := sessionManager.GetSession(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+	history := session.History()
+	if len(history) == 0 {
+		return "", newMessageError("history.empty", param("event", m[0]))
+	}
+
+	var entry *HistoryEntry
+	switch {
+	case m[1] == "!":
+		entry = &history[len(history)-1]
+	case strings.HasPrefix(m[1], "-"):
+		// !-n はn個前のコマンド
+		n, _ := strconv.Atoi(m[1][1:])
+		if n >= 1 && n <= len(history) {
+			entry = &history[len(history)-n]
+		}
+	default:
+		n, _ := strconv.Atoi(m[1])
+		for i := range history {
+			if history[i].Number == n {
+				entry = &history[i]
+				break
+			}
+		}
+	}
+	if entry == nil {
+		return "", newMessageError("history.not_found", param("event", m[1]))
+	}
+	return entry.Command + m[2], nil
+}
+
+// historyBuiltin はセッションのコマンド履歴を表示するコマンド
+// bashのhistoryは無効化されているため、サーバーで保持している履歴を表示する
+type historyBuiltin struct{}
+
+func (historyBuiltin) Name() string               { return "history" }
+func (historyBuiltin) Usage() string              { return "history [件数] | history -s 検索語" }
+func (historyBuiltin) Help() string               { return "コマンド履歴を表示します" }
+func (historyBuiltin) Completion() completionKind { return completeNone }
+
+func (historyBuiltin) Examples() []string {
+	return []string{"history", "history 10", "history -s ls", "!!", "!3", "!-2"}
+}
+
+func (historyBuiltin) Options() []CommandOption {
+	return []CommandOption{
+		{Flag: "N", Description: "直近のN件のみを表示します"},
+		{Flag: "-s WORD", Description: "WORDを含むコマンドのみを表示します"},
+	}
+}
+
+// Run は引数なしで全件、数値を指定すると直近のn件、-s で指定した文字列を含む履歴を表示する
+func (historyBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	history := session.History()
+
+	switch {
+	case len(args) == 0:
+	case len(args) == 1 && args[0] != "-s":
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return "", newMessageError("history.invalid_count", param("count", args[0]))
+		}
+		if n < len(history) {
+			history = history[len(history)-n:]
+		}
+	case len(args) >= 2 && args[0] == "-s":
+		term := strings.Join(args[1:], " ")
+		var matched []HistoryEntry
+		for _, entry := range history {
+			if strings.Contains(entry.Command, term) {
+				matched = append(matched, entry)
+			}
+		}
+		history = matched
+	default:
+		return "", usageError(ctx, historyBuiltin{})
+	}
+
+	lines := make([]string, 0, len(history))
+	for _, entry := range history {
+		lines = append(lines, fmt.Sprintf("%5d  %s  [%d]  %s", entry.Number, entry.Time.Local().Format("2006-01-02 15:04:05"), entry.ExitCode, entry.Command))
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// メッセージカタログ（言語ごとに、メッセージIDをキーとするJSON）
+//
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// デフォルトの言語
+// メッセージカタログの基準で、他の言語に翻訳がないメッセージもこの言語で表示する
+const defaultLocale = "ja"
+
+// 言語ごとのメッセージカタログ
+var catalogs = loadCatalogs()
+
+// loadCatalogs は組み込みのメッセージカタログを読み込む
+// デフォルトの言語にあるメッセージが他の言語にない場合はpanicする
+func loadCatalogs() map[string]map[string]string {
+	files, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	catalogs := make(map[string]map[string]string, len(files))
+	for _, file := range files {
+		data, err := localeFiles.ReadFile("locales/" + file.Name())
+		if err != nil {
+			panic(err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("メッセージカタログのパースエラー: %s: %v", file.Name(), err))
+		}
+		catalogs[strings.TrimSuffix(file.Name(), path.Ext(file.Name()))] = messages
+	}
+
+	for locale, messages := range catalogs {
+		for id := range catalogs[defaultLocale] {
+			if _, ok := messages[id]; !ok {
+				panic(fmt.Sprintf("メッセージカタログに翻訳がありません: %s: %s", locale, id))
+			}
+		}
+	}
+	return catalogs
+}
+
+// supportedLocales は対応している言語を名前順に返す
+func supportedLocales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// translate はメッセージIDに対応する言語のメッセージを返す
+// 引数がある場合はfmt.Sprintfの書式として展開する。名前付きの引数は値を、エラーは同じ言語のメッセージを展開する
+// 翻訳がない場合はデフォルトの言語、それもない場合はメッセージIDを返す
+func translate(locale, id string, args ...any) string {
+	format, ok := catalogs[locale][id]
+	if !ok {
+		format, ok = catalogs[defaultLocale][id]
+	}
+	if !ok {
+		format = id
+	}
+	if len(args) == 0 {
+		return format
+	}
+	values := make([]any, len(args))
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case errorParam:
+			values[i] = arg.value
+		case error:
+			values[i] = localizeError(locale, arg)
+		default:
+			values[i] = arg
+		}
+	}
+	return fmt.Sprintf(format, values...)
+}
+
+// translateOr はメッセージIDに対応する言語のメッセージを返す
+// 翻訳がない場合はfallbackを返す（ビルトインコマンドの説明など、デフォルトの言語の文言をコードに持つ場合に使用）
+func translateOr(locale, id, fallback string) string {
+	if msg, ok := catalogs[locale][id]; ok {
+		return msg
+	}
+	return fallback
+}
+
+// localeKey は、コンテキストにメッセージの言語を格納するためのキー
+type localeKey struct{}
+
+// withLocale はメッセージの言語を格納したコンテキストを返す
+func withLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// localeFrom はコンテキストに格納されたメッセージの言語を返す
+// 格納されていない場合は設定のデフォルトの言語を返す
+func localeFrom(ctx context.Context) string {
+	if locale, ok := ctx.Value(localeKey{}).(string); ok {
+		return locale
+	}
+	return cfg.Locale
+}
+
+// localize はコンテキストの言語でメッセージを返す
+func localize(ctx context.Context, id string, args ...any) string {
+	return translate(localeFrom(ctx), id, args...)
+}
+
+// resolveLocale はメッセージの言語を求める
+// メッセージで指定された言語、Accept-Language、セッションの言語、設定のデフォルトの言語の順に使用する
+func resolveLocale(payload *Payload) string {
+	if locale := negotiateLocale(payload.Locale); locale != "" {
+		return locale
+	}
+	if locale := negotiateLocale(payload.AcceptLanguage); locale != "" {
+		return locale
+	}
+	if session, ok := sessionManager.Lookup(payload.SessionID); ok {
+		if locale := session.Locale(); locale != "" {
+			return locale
+		}
+	}
+	return cfg.Locale
+}
+
+// negotiateLocale はAccept-Language形式の文字列（例: "en-US,en;q=0.9,ja;q=0.8"）から、対応している言語を選ぶ
+// 品質値（q）が高い順に、地域を除いた言語名で照合する。対応している言語がない場合は空文字列を返す
+func negotiateLocale(header string) string {
+	type candidate struct {
+		locale string
+		q      float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		lang, _, _ = strings.Cut(lang, "_")
+		if _, ok := catalogs[lang]; ok && q > 0 {
+			candidates = append(candidates, candidate{locale: lang, q: q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	if len(candidates) == 0 {
+		return ""
+	}
+	return candidates[0].locale
+}
+
+// messageError は、メッセージIDと引数を持つエラー
+// Error はデフォルトの言語のメッセージを返し、結果に含める際にlocalizeErrorで言語に応じて変換する
+// 引数には名前付きの引数（param）と原因のエラーを含めることができ、エラーコードとパラメータの算出に使用する
+type messageError struct {
+	id   string
+	args []any
+}
+
+// newMessageError は新しいmessageErrorを作成
+func newMessageError(id string, args ...any) error {
+	return &messageError{id: id, args: args}
+}
+
+func (e *messageError) Error() string {
+	return translate(defaultLocale, e.id, e.args...)
+}
+
+// localizeError はエラーを言語に応じたメッセージに変換する
+// 複数のエラーをまとめたエラーは、それぞれを変換して改行で連結する
+// messageErrorを含まないエラーは、ファイルシステムのエラーのみ変換し、それ以外はそのままのメッセージを返す
+// （fmt.Errorfで文脈を付けたエラーは、文脈が失われないようにそのまま返す）
+func localizeError(locale string, err error) string {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		msgs := make([]string, 0, len(joined.Unwrap()))
+		for _, e := range joined.Unwrap() {
+			msgs = append(msgs, localizeError(locale, e))
+		}
+		return strings.Join(msgs, "\n")
+	}
+	var msgErr *messageError
+	if errors.As(err, &msgErr) {
+		return translate(locale, msgErr.id, msgErr.args...)
+	}
+	switch err.(type) {
+	case *fs.PathError, *quotaError:
+		return fsErrorMessage(locale, err)
+	}
+	if fsErrorCode(err) != "" && errors.Unwrap(err) == nil {
+		return fsErrorMessage(locale, err)
+	}
+	return err.Error()
+}
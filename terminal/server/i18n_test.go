@@ -0,0 +1,69 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestNegotiateLocale(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: ""},
+		{header: "ja", want: "ja"},
+		{header: "en", want: "en"},
+		{header: "EN-us", want: "en"},
+		{header: "en_GB", want: "en"},
+		{header: "fr", want: ""},
+		{header: "fr-FR,en;q=0.5", want: "en"},
+		{header: "en-US,en;q=0.9,ja;q=0.8", want: "en"},
+		{header: "ja;q=0.8,en;q=0.9", want: "en"},
+		{header: "en;q=0,ja;q=0.1", want: "ja"},
+		{header: "en;q=abc,ja", want: "ja"},
+		{header: " ja ; q=0.7 , fr", want: "ja"},
+	}
+	for _, tt := range tests {
+		if got := negotiateLocale(tt.header); got != tt.want {
+			t.Errorf("negotiateLocale(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+// 書式の動詞（%s・%dなど）。%% は除く
+var formatVerb = regexp.MustCompile(`%[-+# 0-9.*]*[a-zA-Z%]`)
+
+// TestCatalogFormats は、翻訳のメッセージがデフォルトの言語と同じ書式の動詞を持つことを確認する
+// （引数の数・型が異なると、翻訳した言語でのみ %!(EXTRA ...) などが表示される）
+func TestCatalogFormats(t *testing.T) {
+	verbs := func(format string) []string {
+		var verbs []string
+		for _, verb := range formatVerb.FindAllString(format, -1) {
+			if verb != "%%" {
+				verbs = append(verbs, verb)
+			}
+		}
+		return verbs
+	}
+	for locale, messages := range catalogs {
+		for id, format := range catalogs[defaultLocale] {
+			if got, want := verbs(messages[id]), verbs(format); !slices.Equal(got, want) {
+				t.Errorf("%s: %s: verbs = %q, want %q", locale, id, got, want)
+			}
+		}
+	}
+}
+
+func TestLocalizeMessageError(t *testing.T) {
+	err := newMessageError("builtin.invalid_option", param("command", "ls"), param("option", "-z"))
+	if got, want := localizeError("ja", err), "ls: -z: 無効なオプションです"; got != want {
+		t.Errorf("localizeError(ja) = %q, want %q", got, want)
+	}
+	if got, want := localizeError("en", err), "ls: -z: invalid option"; got != want {
+		t.Errorf("localizeError(en) = %q, want %q", got, want)
+	}
+	if got, want := err.Error(), translate(defaultLocale, "builtin.invalid_option", "ls", "-z"); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
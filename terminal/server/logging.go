@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ログに出力しない（伏せる）属性キーに含まれる文字列
+var secretLogKeys = []string{"password", "secret", "token", "authorization"}
+
+// loggerKey は、コンテキストにリクエスト単位のロガーを格納するためのキー
+type loggerKey struct{}
+
+// setupLogger は設定に従ってデフォルトのロガーを作成する
+// ログはすべて標準エラー出力に出力する（stdioトランスポートが標準出力を使用するため）
+func setupLogger(c *Config) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return fmt.Errorf("不明なログレベルです: %s", c.LogLevel)
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: replaceLogAttr(c.LogMaxFieldSize),
+	}
+
+	var handler slog.Handler
+	switch c.LogFormat {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("不明なログ形式です: %s", c.LogFormat)
+	}
+	slog.SetDefault(slog.New(handler))
+
+	// go-redis内部のログも同じロガーに出力する
+	redis.SetLogger(redisLogger{})
+	return nil
+}
+
+// replaceLogAttr は秘密情報を伏せ、長い値を切り詰める関数を返す
+func replaceLogAttr(maxSize int) func(groups []string, a slog.Attr) slog.Attr {
+	return func(groups []string, a slog.Attr) slog.Attr {
+		if isSecretLogKey(a.Key) {
+			return slog.String(a.Key, redact(a.Value.String()))
+		}
+
+		switch a.Value.Kind() {
+		case slog.KindString:
+			a.Value = slog.StringValue(truncate(a.Value.String(), maxSize))
+		case slog.KindAny:
+			// エラーには受信したペイロードなどが含まれるため切り詰める
+			if err, ok := a.Value.Any().(error); ok {
+				a.Value = slog.StringValue(truncate(err.Error(), maxSize))
+			}
+		}
+		return a
+	}
+}
+
+// isSecretLogKey は属性キーが秘密情報を表すかどうかを返す
+func isSecretLogKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range secretLogKeys {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate は文字列を最大バイト数で切り詰め、切り詰めたバイト数を付加する
+// マルチバイト文字の途中で切らないようにする
+func truncate(s string, maxSize int) string {
+	if maxSize <= 0 || len(s) <= maxSize {
+		return s
+	}
+	cut := maxSize
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s...(%dバイト省略)", s[:cut], len(s)-cut)
+}
+
+// withLogger はロガーを格納したコンテキストを返す
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// loggerFrom はコンテキストに格納されたロガーを返す
+// 格納されていない場合はデフォルトのロガーを返す
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// redisLogger は、go-redis内部のログをslogに出力するためのアダプター
+type redisLogger struct{}
+
+// Printf はgo-redisのログを警告レベルで出力する
+func (redisLogger) Printf(ctx context.Context, format string, v ...interface{}) {
+	slog.WarnContext(ctx, fmt.Sprintf(format, v...), "component", "go-redis")
+}
@@ -2,94 +2,423 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
-)
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-// 定数を定義
-const (
-	commandChannel = "terminal:commands"	// コマンド受信用チャンネル
-	resultChannel  = "terminal:results"	// 結果送信用チャンネル
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// シャットダウン時に未送信のスパンを出力する最大時間
+const tracingShutdownTimeout = 5 * time.Second
+
 // main はアプリケーションのエントリーポイント
-// Redisとの接続確立とコマンド処理ループを開始
+// トランスポートを起動し、コマンド処理ループを開始
+// SIGTERM/SIGINTを受信すると新しいコマンドの受け付けを停止し、グレースフルシャットダウンを行う
 func main() {
+	// 実行時設定を読み込む
+	loaded, err := LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fatal("設定の読み込みに失敗しました", err)
+	}
+	cfg = loaded
+
+	// ロガーを設定する
+	if err := setupLogger(cfg); err != nil {
+		fatal("ロガーの設定に失敗しました", err)
+	}
+
+	// トレースの出力先を設定する
+	shutdownTracing, err := setupTracing(context.Background(), cfg)
+	if err != nil {
+		fatal("トレースの設定に失敗しました", err)
+	}
+	defer func() {
+		// 未送信のスパンを出力してから終了する
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Warn("トレースの出力エラー", "error", err)
+		}
+	}()
+
+	// コマンドポリシーを読み込む
+	policy, err = LoadPolicy(cfg.PolicyPath)
+	if err != nil {
+		fatal("ポリシーの読み込みに失敗しました", err)
+	}
+
+	// ビルトインコマンドが参照するファイルシステムを設定する
+	if err := setupFileSystem(cfg); err != nil {
+		fatal("ファイルシステムの設定に失敗しました", err)
+	}
 
 	// コンテキストを作成
 	ctx := context.Background()
 
-	// RedisのPub/Subをセットアップ
-	ch, rdb := setupRedisPubSub(ctx, commandChannel)
-	// deferを使用して、プログラム終了時にRedisクライアントをクローズ
-	defer rdb.Close()
+	// シグナルを受信するとキャンセルされるコンテキスト
+	// コマンドの受け付けを停止するために使用する
+	sigCtx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	// 実行中のコマンドを強制終了するためのコンテキスト
+	// シグナル受信後、猶予期間が過ぎるとキャンセルされる
+	execCtx, cancelExec := context.WithCancel(ctx)
+	defer cancelExec()
+
+	// トランスポートを作成
+	transport, err := newTransport(ctx, cfg.Transport)
+	if err != nil {
+		fatal("トランスポートの作成に失敗しました", err)
+	}
+	// deferを使用して、プログラム終了時にトランスポートをクローズ
+	defer transport.Close()
 
-	// メッセージを受信するためのループを開始
-	for msg := range ch {
-		// 受信したメッセージをログに出力
-		log.Printf("メッセージを受信: %s", msg.Payload)
+	// セッションの状態の保存先を設定
+	store, err := newSessionStore(cfg.SessionStore)
+	if err != nil {
+		fatal("セッションの保存先の作成に失敗しました", err)
+	}
+	if store != nil {
+		sessionManager.SetStore(store)
+		defer store.Close()
+	}
 
-		// 受信したメッセージをパース
-		// 不正であったり、空のメッセージはスキップ
-		payload, err := parsePayload(msg.Payload)
+	// 仮想ファイルシステムへの書き込みの保存先を設定
+	if cfg.FSMode == "virtual" {
+		overlays, err := newOverlayStore(cfg.OverlayStore)
 		if err != nil {
-			log.Printf("パース失敗: %v", err)
-			// TODO: パースに失敗した場合、sessionIDを取得することができない→resultを出しても、APIが受け取れるかわからない
-			continue
+			fatal("書き込みの保存先の作成に失敗しました", err)
 		}
+		if overlays != nil {
+			sessionManager.SetOverlayStore(overlays)
+			defer overlays.Close()
+		}
+	}
 
-		// コマンドのバリデーション
-		if err := valivateCommand(payload.Command); err != nil {
-			log.Printf("コマンドバリデーションエラー: %v", err)
-			result := CommandResult{
-				Status:    "error",
-				Command:   payload.Command,
-				Error:     fmt.Sprintf("バリデーションエラー: %v", err),
-				SessionID: payload.SessionID,
+	// 保存期間を過ぎた録画を定期的に削除する
+	if cfg.RecordMode != "off" {
+		startRecordingCleanup(sigCtx, cfg.RecordDir, cfg.RecordRetention)
+	}
+
+	// コマンドを処理するワーカーを起動
+	dispatcher := NewDispatcher(cfg.Workers, cfg.WorkerQueueSize, handlePayload)
+	dispatcher.Start(execCtx, ctx)
+
+	// メトリクス・ヘルスチェックのサーバーを起動（アドレスが指定されている場合のみ）
+	for _, server := range startOpsServers(dispatcher, transport) {
+		defer server.Close()
+	}
+
+	// メッセージの受信を開始
+	messages, err := transport.Listen(ctx)
+	if err != nil {
+		fatal("メッセージの受信開始に失敗しました", err)
+	}
+
+	// シグナル受信後、猶予期間が過ぎたら実行中のコマンドを強制終了する
+	go func() {
+		<-sigCtx.Done()
+		slog.Info("シャットダウンを開始します", "grace", cfg.ShutdownGrace)
+		select {
+		case <-time.After(cfg.ShutdownGrace):
+			slog.Warn("猶予期間を過ぎたため実行中のコマンドを強制終了します")
+			cancelExec()
+		case <-execCtx.Done():
+		}
+	}()
+
+	// メッセージを受信してワーカーに振り分けるループを開始
+	// 一定間隔で生存を記録し、ループの停止をヘルスチェックで検出できるようにする
+	heartbeat := time.NewTicker(dispatchHeartbeatInterval)
+	defer heartbeat.Stop()
+	for running := true; running; {
+		select {
+		case <-sigCtx.Done():
+			running = false
+		case <-heartbeat.C:
+			dispatcher.Beat()
+		case msg, ok := <-messages:
+			// シグナル受信後に届いたメッセージは処理しない
+			if !ok || sigCtx.Err() != nil {
+				running = false
+				break
+			}
+			dispatcher.Beat()
+
+			// 受信したメッセージをログに出力
+			slog.Debug("メッセージを受信", "payload", msg.Payload)
+			commandsReceived.Inc()
+
+			payload, span, err := decodeMessage(msg.Payload)
+			if err != nil {
+				continue
+			}
+			payload.Client = msg.Client
+			// WebSocketで接続した場合は、接続時のAccept-Languageを使用する
+			if payload.AcceptLanguage == "" {
+				payload.AcceptLanguage = msg.AcceptLanguage
 			}
-			// 結果をRedisの結果チャンネルに送信
-			if err := publishResult(ctx, rdb, &result); err != nil {
-				log.Printf("結果のパブリッシュエラー: %v", err)
+			// 中断の対象のコマンドは、同じセッションのワーカーで実行中のため振り分けずに処理する
+			if payload.Type == "interrupt" {
+				handleInterrupt(ctx, msg, payload, span)
+				continue
+			}
+			if err := dispatcher.Dispatch(sigCtx, msg, payload, span); err != nil {
+				recordSpanError(span, err)
+				span.End()
+				running = false
 			}
-			continue
 		}
+	}
+
+	// 実行中のコマンドの完了を待ってからセッションを終了する
+	// シグナルによる停止の場合はキューに残ったコマンドを実行しない
+	// 入力の終了（標準入力のEOFなど）による停止の場合は受信済みのコマンドをすべて実行する
+	dispatcher.Stop(sigCtx.Err() != nil)
+	shutdown(ctx, transport)
+}
 
-		// コマンドを実行し、結果を取得
-		result, err := executeCommand(payload.Command, payload.SessionID)
+// shutdown は全セッションにシャットダウンを通知し、セッションを終了する
+// 通知はリクエストへの返信ではないため request_id を付けずに送信する（APIは request_id で返信を識別する）
+func shutdown(ctx context.Context, transport Transport) {
+	for _, sessionID := range sessionManager.SessionIDs() {
+		notice := CommandResult{
+			Status:    "notice",
+			Result:    translate(resolveLocale(&Payload{SessionID: sessionID}), "notice.shutdown"),
+			SessionID: sessionID,
+		}
+		if err := transport.Publish(ctx, &notice); err != nil {
+			slog.Warn("シャットダウン通知の送信エラー", "error", err, "session_id", sessionID)
+		}
+	}
+
+	sessionManager.CloseAll()
+	slog.Info("シャットダウンが完了しました")
+}
+
+// newTransport は名前に対応するトランスポートを作成
+func newTransport(ctx context.Context, name string) (Transport, error) {
+	switch name {
+	case "redis":
+		return NewRedisTransport(ctx, cfg.Redis)
+	case "websocket":
+		return NewWebSocketTransport(cfg.Listen, cfg.WSPath, cfg.WSOrigins), nil
+	case "stdio":
+		return NewStdioTransport(), nil
+	default:
+		return nil, fmt.Errorf("不明なトランスポートです: %s", name)
+	}
+}
+
+// fatal はエラーをログに出力して終了する
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// decodeMessage は受信したメッセージをパースし、リクエストIDとセッションIDを補完する
+// コマンド1件の処理全体を表すスパンを開始して返す
+// パースに失敗した場合は返信先が分からないためエラーを返す
+func decodeMessage(rawPayload string) (*Payload, trace.Span, error) {
+	received := time.Now()
+
+	// 受信したメッセージをパース
+	// 不正であったり、空のメッセージはスキップ
+	payload, err := parsePayload(rawPayload)
+	if err != nil {
+		slog.Warn("パース失敗", "error", err)
+		commandsRejected.WithLabelValues(reasonParseError).Inc()
+		// 親スパンが分からないため、パースのスパンのみを記録する
+		_, span := tracer.Start(context.Background(), "parse", trace.WithTimestamp(received))
+		recordSpanError(span, err)
+		span.End()
+		// TODO: パースに失敗した場合、sessionIDを取得することができない→resultを出しても、APIが受け取れるかわからない
+		return nil, nil, err
+	}
+
+	// リクエストIDが指定されていない場合は新規作成
+	if payload.RequestID == "" {
+		payload.RequestID = uuid.New().String()
+	}
+	// セッションIDが指定されていない場合は新規作成
+	if payload.SessionID == "" {
+		payload.SessionID = uuid.New().String()
+		slog.Info("新規セッションIDを生成", "session_id", payload.SessionID, "request_id", payload.RequestID)
+	}
+
+	ctx, span := startRequestSpan(payload, received)
+	_, parseSpan := tracer.Start(ctx, "parse", trace.WithTimestamp(received))
+	parseSpan.End()
+	return payload, span, nil
+}
+
+// handleInterrupt はセッションで実行中のコマンドを中断（Ctrl-C）し、結果を返信する
+func handleInterrupt(ctx context.Context, msg *Message, payload *Payload, span trace.Span) {
+	result := &CommandResult{
+		Status:    "success",
+		Command:   payload.Command,
+		SessionID: payload.SessionID,
+		RequestID: payload.RequestID,
+	}
+	session, exists := sessionManager.Lookup(payload.SessionID)
+	if exists && session.interrupt(errInterrupted) {
+		slog.Info("コマンドを中断", "session_id", payload.SessionID, "request_id", payload.RequestID)
+	} else {
+		result.setError(resolveLocale(payload), newMessageError("error.no_running_command"))
+	}
+
+	if err := msg.Reply(ctx, result); err != nil {
+		slog.Error("結果のパブリッシュエラー", "error", err, "session_id", result.SessionID, "request_id", result.RequestID)
+		recordSpanError(span, err)
+	}
+	endRequestSpan(span, result)
+}
+
+// handlePayload はコマンドを処理し、送信すべき結果を返す
+// ワーカーから呼び出される
+func handlePayload(ctx context.Context, payload *Payload) *CommandResult {
+	// 以降のログにはリクエストIDとセッションIDを付加する
+	logger := slog.With("request_id", payload.RequestID, "session_id", payload.SessionID)
+	ctx = withLogger(ctx, logger)
+	// メッセージ・helpなどの出力はリクエストの言語で返す
+	ctx = withLocale(ctx, resolveLocale(payload))
+	logger.Info("コマンドを受信", "command", payload.Command)
+
+	result := processPayload(ctx, payload)
+	result.RequestID = payload.RequestID
+	return result
+}
+
+// processPayload はコマンドのバリデーション・実行・結果のバリデーションを行う
+func processPayload(ctx context.Context, payload *Payload) *CommandResult {
+	logger := loggerFrom(ctx)
+
+	// メッセージの種類に応じて処理する
+	// 補完はコマンドを実行しないため、メンテナンス中でも受け付ける
+	// 中断（interrupt）はワーカーに振り分ける前に処理する
+	switch payload.Type {
+	case "", "command":
+	case "complete":
+		result, err := completeCommand(ctx, payload)
 		if err != nil {
-			log.Printf("コマンド実行エラー: %v", err)
-			result = CommandResult{
-				Status:    "error",
+			logger.Warn("補完エラー", "error", err)
+			result := &CommandResult{
 				Command:   payload.Command,
-				Error:     fmt.Sprintf("実行エラー: %v", err),
 				SessionID: payload.SessionID,
 			}
-			if err := publishResult(ctx, rdb, &result); err != nil {
-				log.Printf("結果のパブリッシュエラー: %v", err)
-			}
-			continue
+			result.setError(localeFrom(ctx), newMessageError("error.session", err))
+			return result
 		}
+		return &result
+	default:
+		logger.Info("不明なメッセージの種類", "type", payload.Type)
+		commandsRejected.WithLabelValues(reasonParseError).Inc()
+		result := &CommandResult{
+			Command:   payload.Command,
+			SessionID: payload.SessionID,
+		}
+		result.setError(localeFrom(ctx), newMessageError("error.unknown_message_type", param("type", payload.Type)))
+		return result
+	}
 
-		// コマンドの実行結果をバリデーション
-		if err := validateCommandResult(&result); err != nil {
-			log.Printf("コマンド結果バリデーションエラー: %v", err)
-			result = CommandResult{
-				Status:    "error",
-				Command:   payload.Command,
-				Error:     fmt.Sprintf("バリデーションエラー: %v", err),
-				SessionID: payload.SessionID,
-			}
-			// 結果をRedisの結果チャンネルに送信
-			if err := publishResult(ctx, rdb, &result); err != nil {
-				log.Printf("結果のパブリッシュエラー: %v", err)
-			}
-			continue
+	// メンテナンス中は新しいコマンドを受け付けない
+	if enabled, message := maintenance.Get(); enabled {
+		logger.Info("メンテナンス中のためコマンドを拒否")
+		commandsRejected.WithLabelValues(reasonMaintenance).Inc()
+		result := &CommandResult{
+			Command:   payload.Command,
+			SessionID: payload.SessionID,
+		}
+		err := newMessageError("error.maintenance", param("message", message))
+		if message == "" {
+			// メッセージを指定していない場合は、言語に応じたデフォルトのメッセージを返す
+			err = newMessageError("error.maintenance_default")
+		}
+		result.setError(localeFrom(ctx), err)
+		return result
+	}
+
+	// 履歴を参照するコマンド（!!、!n）を展開する
+	// 展開後のコマンドをバリデーション・実行する
+	expanded, err := expandHistory(ctx, payload.Command, payload.SessionID)
+	if err != nil {
+		logger.Info("履歴の展開エラー", "error", err)
+		commandsRejected.WithLabelValues(reasonHistory).Inc()
+		result := &CommandResult{
+			Command:   payload.Command,
+			SessionID: payload.SessionID,
+		}
+		result.setError(localeFrom(ctx), err)
+		return result
+	}
+	if expanded != payload.Command {
+		logger.Info("履歴を展開", "command", expanded)
+		payload.Command = expanded
+	}
+
+	// コマンドのバリデーション
+	_, span := tracer.Start(ctx, "validate")
+	err = valivateCommand(payload.Command)
+	if err != nil {
+		recordSpanError(span, err)
+	}
+	span.End()
+	if err != nil {
+		logger.Info("コマンドバリデーションエラー", "error", err)
+		commandsRejected.WithLabelValues(reasonValidation).Inc()
+		result := &CommandResult{
+			Command:   payload.Command,
+			SessionID: payload.SessionID,
 		}
+		result.setError(localeFrom(ctx), newMessageError("error.validation", err))
+		return result
+	}
 
-		// 結果をRedisの結果チャンネルに送信
-		if err := publishResult(ctx, rdb, &result); err != nil {
-			log.Printf("結果のパブリッシュエラー: %v", err)
-			continue
+	// コマンドを実行し、結果を取得
+	// タイムアウトが設定されている場合は、時間内に終了しないコマンドを強制終了する
+	if cfg.CommandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.CommandTimeout)
+		defer cancel()
+	}
+	result, err := executeCommand(ctx, payload)
+	if err != nil {
+		logger.Error("コマンド実行エラー", "error", err)
+		result := &CommandResult{
+			Command:   payload.Command,
+			SessionID: payload.SessionID,
 		}
+		result.setError(localeFrom(ctx), newMessageError("error.execute", err))
+		return result
 	}
+
+	// コマンドの実行結果をバリデーション
+	_, span = tracer.Start(ctx, "validate_result")
+	err = validateCommandResult(&result)
+	if err != nil {
+		recordSpanError(span, err)
+	}
+	span.End()
+	if err != nil {
+		logger.Warn("コマンド結果バリデーションエラー", "error", err)
+		commandsRejected.WithLabelValues(reasonInvalidResult).Inc()
+		result := &CommandResult{
+			Command:   payload.Command,
+			SessionID: payload.SessionID,
+		}
+		result.setError(localeFrom(ctx), newMessageError("error.validation", err))
+		return result
+	}
+
+	return &result
 }
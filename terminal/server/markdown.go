@@ -0,0 +1,556 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ANSIエスケープシーケンス（Markdownの表示に使用する）
+const (
+	ansiReset     = "\x1b[0m"
+	ansiBold      = "\x1b[1m"
+	ansiDim       = "\x1b[2m"
+	ansiItalic    = "\x1b[3m"
+	ansiUnderline = "\x1b[4m"
+	ansiStrike    = "\x1b[9m"
+	ansiBlue      = "\x1b[34m"
+	ansiMagenta   = "\x1b[35m"
+	ansiCyan      = "\x1b[36m"
+	ansiYellow    = "\x1b[33m"
+)
+
+// 折り返す最小の幅（端末の幅が極端に狭い場合でも、この幅で折り返す）
+const markdownMinWidth = 20
+
+// 行頭に置かない文字（直前の文字と一緒に折り返す）と、行末に置かない文字（直後の文字と一緒に折り返す）
+const (
+	mdNoLineStart = "、。，．）」』】〕！？・ー"
+	mdNoLineEnd   = "（「『【〔"
+)
+
+// Markdownのブロック要素の行
+var (
+	mdFencePattern   = regexp.MustCompile("^\\s*(```|~~~)")
+	mdHeadingPattern = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdRulePattern    = regexp.MustCompile(`^\s*([-*_])(\s*([-*_])){2,}\s*$`)
+	mdListPattern    = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+	mdQuotePattern   = regexp.MustCompile(`^\s*>\s?(.*)$`)
+	mdSetextPattern  = regexp.MustCompile(`^\s*(=+|-+)\s*$`) // 前の行を見出しにする下線（= はレベル1、- はレベル2）
+)
+
+// isMarkdown はMarkdownとして表示するファイルかどうかを拡張子で判定する
+func isMarkdown(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.HasSuffix(lower, ".md") || strings.HasSuffix(lower, ".markdown")
+}
+
+// mdSpan は、同じ装飾を付ける文字列（インライン要素の解析結果）
+type mdSpan struct {
+	text  string
+	style []string // ANSIエスケープシーケンス（装飾なしの場合は空）
+	link  string   // リンク先のURL（OSC 8のハイパーリンクを付ける、リンクでない場合は空）
+}
+
+// markdownRenderer は、Markdownを端末の幅に合わせてANSIエスケープシーケンスで装飾する構造体
+// 見出し・強調・インラインコード・リンク・リスト・引用・コードブロック・区切り線に対応する
+// リンクには、対応している端末でクリックして開けるようOSC 8のハイパーリンクを付ける（装飾が有効な場合のみ）
+type markdownRenderer struct {
+	b     strings.Builder
+	width int  // 端末の幅（桁数）
+	color bool // ANSIエスケープシーケンスで装飾するかどうか
+}
+
+// renderMarkdown はMarkdownを端末に表示する文字列に変換する
+func renderMarkdown(src string, width int, color bool) string {
+	r := &markdownRenderer{width: max(width, markdownMinWidth), color: color}
+	r.render(strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n"))
+	return strings.TrimRight(r.b.String(), "\n")
+}
+
+// render はMarkdownの行をブロック要素ごとに書き込む
+func (r *markdownRenderer) render(lines []string) {
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			r.block(r.wrap(parseInline(joinLines(paragraph)), r.width, "", ""))
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case len(paragraph) == 0 && i+1 < len(lines) && mdSetextPattern.MatchString(lines[i+1]) && !mdListPattern.MatchString(line):
+			level := 1
+			if strings.TrimSpace(lines[i+1])[0] == '-' {
+				level = 2
+			}
+			r.heading(level, strings.TrimSpace(line))
+			i++
+		case mdFencePattern.MatchString(line):
+			flush()
+			fence := mdFencePattern.FindStringSubmatch(line)[1]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			r.codeBlock(code)
+		case mdHeadingPattern.MatchString(line):
+			flush()
+			m := mdHeadingPattern.FindStringSubmatch(line)
+			r.heading(len(m[1]), m[2])
+		case mdRulePattern.MatchString(line):
+			flush()
+			r.block([]string{r.style(strings.Repeat("─", min(r.width, 40)), ansiDim)})
+		case mdQuotePattern.MatchString(line):
+			flush()
+			var quote []string
+			for ; i < len(lines) && mdQuotePattern.MatchString(lines[i]); i++ {
+				quote = append(quote, mdQuotePattern.FindStringSubmatch(lines[i])[1])
+			}
+			i--
+			bar := r.style("│ ", ansiDim)
+			r.block(r.wrap(parseInline(joinLines(quote)), r.width-2, bar, bar))
+		case mdListPattern.MatchString(line):
+			flush()
+			i = r.list(lines, i)
+		default:
+			paragraph = append(paragraph, strings.TrimSpace(line))
+		}
+	}
+	flush()
+}
+
+// block はブロック要素の行を書き込み、次のブロック要素との間に空行を入れる
+func (r *markdownRenderer) block(lines []string) {
+	for _, line := range lines {
+		r.b.WriteString(line + "\n")
+	}
+	r.b.WriteString("\n")
+}
+
+// heading は見出しを書き込む
+// レベル1・2は色と下線で、それ以降は太字で区別する
+func (r *markdownRenderer) heading(level int, text string) {
+	var style []string
+	switch level {
+	case 1:
+		style = []string{ansiBold, ansiUnderline, ansiMagenta}
+	case 2:
+		style = []string{ansiBold, ansiCyan}
+	default:
+		style = []string{ansiBold}
+	}
+	spans := parseInline(text)
+	for i := range spans {
+		spans[i].style = append(style, spans[i].style...)
+	}
+	r.block(r.wrap(spans, r.width, "", ""))
+}
+
+// codeBlock はコードブロックを字下げして書き込む
+// コードは折り返さず、書いたとおりに表示する
+func (r *markdownRenderer) codeBlock(lines []string) {
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i] = "  " + r.style(strings.ReplaceAll(line, "\t", "    "), ansiYellow)
+	}
+	r.block(out)
+}
+
+// list はlines[start]から続くリストを書き込み、リストの最後の行の位置を返す
+// 字下げの深さで入れ子を表し、記号のない字下げした行は直前の項目の続きとして扱う
+func (r *markdownRenderer) list(lines []string, start int) int {
+	type item struct {
+		depth  int
+		marker string
+		text   []string
+	}
+	var items []*item
+	i := start
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if m := mdListPattern.FindStringSubmatch(line); m != nil {
+			marker := "•"
+			if n, err := strconv.Atoi(strings.TrimRight(m[2], ".)")); err == nil {
+				marker = strconv.Itoa(n) + "."
+			}
+			depth := len(strings.ReplaceAll(m[1], "\t", "    ")) / 2
+			items = append(items, &item{depth: depth, marker: marker, text: []string{m[3]}})
+			continue
+		}
+		if strings.TrimSpace(line) == "" || !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			break
+		}
+		last := items[len(items)-1]
+		last.text = append(last.text, strings.TrimSpace(line))
+	}
+
+	var out []string
+	for _, it := range items {
+		indent := strings.Repeat("  ", it.depth+1)
+		first := indent + r.style(it.marker, ansiCyan) + " "
+		rest := indent + strings.Repeat(" ", displayWidth(it.marker)+1)
+		width := r.width - displayWidth(rest)
+		out = append(out, r.wrap(parseInline(joinLines(it.text)), width, first, rest)...)
+	}
+	r.block(out)
+	return i - 1
+}
+
+// style は装飾が有効な場合のみ、文字列をエスケープシーケンスで囲む
+func (r *markdownRenderer) style(s string, codes ...string) string {
+	if !r.color || len(codes) == 0 || s == "" {
+		return s
+	}
+	return strings.Join(codes, "") + s + ansiReset
+}
+
+// joinLines は段落の行を連結する
+// 英文は空白を挟んで連結し、全角文字どうしの改行は空白を挟まずに連結する
+func joinLines(lines []string) string {
+	var b strings.Builder
+	for i, line := range lines {
+		if i > 0 && b.Len() > 0 && line != "" {
+			last, _ := utf8.DecodeLastRuneInString(b.String())
+			next, _ := utf8.DecodeRuneInString(line)
+			if runeWidth(last) != 2 || runeWidth(next) != 2 {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// wrap はインライン要素を指定した表示幅で折り返し、装飾した行を返す
+// 1行目の先頭にはfirst、2行目以降の先頭にはrestを付ける
+// 装飾は行ごとに付け直し、折り返した行の先頭の字下げや記号に装飾が及ばないようにする
+func (r *markdownRenderer) wrap(spans []mdSpan, width int, first, rest string) []string {
+	width = max(width, 2)
+	var lines []string
+	var line []mdSpan // 装飾が同じ部分をまとめた、折り返し中の行
+	lineWidth := 0
+	prefix := first
+	add := func(text string, span mdSpan) {
+		if n := len(line); n > 0 && slices.Equal(line[n-1].style, span.style) && line[n-1].link == span.link {
+			line[n-1].text += text
+			return
+		}
+		line = append(line, mdSpan{text: text, style: span.style, link: span.link})
+	}
+	flush := func() {
+		var b strings.Builder
+		b.WriteString(prefix)
+		for i, span := range line {
+			if i == len(line)-1 {
+				span.text = strings.TrimRight(span.text, " ")
+			}
+			text := r.style(span.text, span.style...)
+			if r.color && span.link != "" && strings.TrimSpace(span.text) != "" {
+				text = hyperlink(span.link, text)
+			}
+			b.WriteString(text)
+		}
+		lines = append(lines, strings.TrimRight(b.String(), " "))
+		line = nil
+		lineWidth = 0
+		prefix = rest
+	}
+
+	// 折り返しの単位に分割する
+	// 装飾の境界をまたいで続く単語（「`code`.」など）は、1つの単位として折り返す
+	type piece struct {
+		text string
+		span mdSpan
+	}
+	var units [][]piece
+	prev := ""
+	for _, span := range spans {
+		for i, token := range tokenizeText(span.text) {
+			if n := len(units); i == 0 && n > 0 && mdJoined(prev, token) {
+				units[n-1] = append(units[n-1], piece{text: token, span: span})
+			} else {
+				units = append(units, []piece{{text: token, span: span}})
+			}
+			prev = token
+		}
+	}
+
+	for _, unit := range units {
+		unitWidth := 0
+		for _, p := range unit {
+			unitWidth += displayWidth(p.text)
+		}
+		if lineWidth > 0 && lineWidth+unitWidth > width {
+			flush()
+			if unit[0].text == " " {
+				continue
+			}
+		}
+		if lineWidth == 0 && unit[0].text == " " {
+			continue
+		}
+		for _, p := range unit {
+			token, w := p.text, displayWidth(p.text)
+			// 1単語が幅を超える場合は文字単位で分割する
+			for w > width-lineWidth {
+				head, headWidth := cutWidth(token, width-lineWidth)
+				add(head, p.span)
+				flush()
+				token, w = token[len(head):], w-headWidth
+			}
+			add(token, p.span)
+			lineWidth += w
+		}
+	}
+	if len(line) > 0 || len(lines) == 0 {
+		flush()
+	}
+	return lines
+}
+
+// parseInline は強調・インラインコード・リンクを解析する
+// **太字**・__太字__、*斜体*・_斜体_、~~取り消し線~~、`コード`、[テキスト](URL)、<URL> に対応する
+func parseInline(s string) []mdSpan {
+	var spans []mdSpan
+	var plain strings.Builder
+	push := func(span mdSpan) {
+		if plain.Len() > 0 {
+			spans = append(spans, mdSpan{text: plain.String()})
+			plain.Reset()
+		}
+		if span.text != "" {
+			spans = append(spans, span)
+		}
+	}
+	emit := func(text string, style ...string) {
+		push(mdSpan{text: text, style: style})
+	}
+	// nested は内側のインライン要素に装飾を加える（内側の装飾・リンクは保持する）
+	nested := func(inner string, style ...string) {
+		for _, span := range parseInline(inner) {
+			span.style = append(slices.Clone(style), span.style...)
+			push(span)
+		}
+	}
+
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		switch {
+		case rest[0] == '\\' && len(rest) > 1 && strings.ContainsRune("\\`*_[]()<>~#", rune(rest[1])):
+			plain.WriteByte(rest[1])
+			i += 2
+			continue
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end >= 0 {
+				emit(rest[1:end+1], ansiYellow)
+				i += end + 2
+				continue
+			}
+		case strings.HasPrefix(rest, "**"), strings.HasPrefix(rest, "__"):
+			if inner, n, ok := delimited(s, i, rest[:2]); ok {
+				nested(inner, ansiBold)
+				i += n
+				continue
+			}
+		case strings.HasPrefix(rest, "~~"):
+			if inner, n, ok := delimited(s, i, "~~"); ok {
+				emit(inner, ansiStrike)
+				i += n
+				continue
+			}
+		case rest[0] == '*', rest[0] == '_':
+			if inner, n, ok := delimited(s, i, rest[:1]); ok {
+				nested(inner, ansiItalic)
+				i += n
+				continue
+			}
+		case rest[0] == '[':
+			if text, url, n, ok := parseLink(rest); ok {
+				for _, span := range parseInline(text) {
+					span.style = append([]string{ansiUnderline, ansiBlue}, span.style...)
+					span.link = url
+					push(span)
+				}
+				if url != text {
+					emit(" ("+url+")", ansiDim)
+				}
+				i += n
+				continue
+			}
+		case rest[0] == '<':
+			if end := strings.IndexByte(rest, '>'); end > 0 && strings.Contains(rest[1:end], "://") {
+				push(mdSpan{text: rest[1:end], style: []string{ansiUnderline, ansiBlue}, link: rest[1:end]})
+				i += end + 1
+				continue
+			}
+		}
+		plain.WriteByte(s[i])
+		i++
+	}
+	emit("")
+	return spans
+}
+
+// delimited はs[i:]が区切り文字で囲まれている場合に、内側の文字列と区切り文字を含む長さを返す
+// 区切り文字の直後・直前が空白の場合と、単語の途中の _ は強調として扱わない（例: snake_case）
+func delimited(s string, i int, delim string) (string, int, bool) {
+	start := i + len(delim)
+	if start >= len(s) || s[start] == ' ' {
+		return "", 0, false
+	}
+	if delim[0] == '_' && i > 0 && isWordByte(s[i-1]) {
+		return "", 0, false
+	}
+	for j := start + 1; j+len(delim) <= len(s); j++ {
+		if s[j:j+len(delim)] != delim || s[j-1] == ' ' {
+			continue
+		}
+		end := j + len(delim)
+		if delim[0] == '_' && end < len(s) && isWordByte(s[end]) {
+			continue
+		}
+		return s[start:j], end - i, true
+	}
+	return "", 0, false
+}
+
+// parseLink は[テキスト](URL)形式のリンクを解析し、テキスト・URL・全体の長さを返す
+func parseLink(s string) (string, string, int, bool) {
+	closeText := strings.Index(s, "](")
+	if closeText < 0 {
+		return "", "", 0, false
+	}
+	closeURL := strings.IndexByte(s[closeText+2:], ')')
+	if closeURL < 0 {
+		return "", "", 0, false
+	}
+	text := s[1:closeText]
+	url := strings.TrimSpace(s[closeText+2 : closeText+2+closeURL])
+	return text, url, closeText + 2 + closeURL + 1, true
+}
+
+// isWordByte は英数字かどうかを返す（マルチバイト文字は単語の一部として扱う）
+func isWordByte(c byte) bool {
+	return c >= 0x80 || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
+
+// tokenizeText は文字列を、折り返しの単位（英単語・空白・全角文字1文字）に分割する
+// 行頭・行末に置かない記号は、前後の単位とつなげて1つの単位にする
+func tokenizeText(text string) []string {
+	var tokens []string
+	var word strings.Builder
+	glue := false // 直前の開き括弧と次の単位をつなげるかどうか
+	push := func(s string) {
+		if glue && len(tokens) > 0 {
+			tokens[len(tokens)-1] += s
+			glue = false
+			return
+		}
+		tokens = append(tokens, s)
+	}
+	pushWord := func() {
+		if word.Len() > 0 {
+			push(word.String())
+			word.Reset()
+		}
+	}
+
+	for _, c := range text {
+		switch {
+		case c == ' ' || c == '\t':
+			pushWord()
+			glue = false
+			tokens = append(tokens, " ")
+		case strings.ContainsRune(mdNoLineStart, c):
+			pushWord()
+			if n := len(tokens); n > 0 && tokens[n-1] != " " {
+				tokens[n-1] += string(c)
+			} else {
+				push(string(c))
+			}
+		case strings.ContainsRune(mdNoLineEnd, c):
+			pushWord()
+			push(string(c))
+			glue = true
+		case runeWidth(c) == 2:
+			pushWord()
+			push(string(c))
+		default:
+			word.WriteRune(c)
+		}
+	}
+	pushWord()
+	return tokens
+}
+
+// mdJoined は、装飾の境界をはさんだ2つの単位を折り返さずにつなげるかどうかを返す
+// tokenizeTextと同じく、空白をはさまない英単語どうしと、行頭・行末に置かない記号の前後をつなげる
+func mdJoined(prev, next string) bool {
+	if prev == "" || next == "" {
+		return false
+	}
+	last, _ := utf8.DecodeLastRuneInString(prev)
+	first, _ := utf8.DecodeRuneInString(next)
+	switch {
+	case last == ' ' || first == ' ':
+		return false
+	case strings.ContainsRune(mdNoLineStart, first), strings.ContainsRune(mdNoLineEnd, last):
+		return true
+	}
+	return runeWidth(last) != 2 && runeWidth(first) != 2
+}
+
+// cutWidth は文字列の先頭から、指定した表示幅に収まる部分とその幅を返す
+func cutWidth(s string, width int) (string, int) {
+	w := 0
+	for i, c := range s {
+		if w+runeWidth(c) > width {
+			return s[:i], w
+		}
+		w += runeWidth(c)
+	}
+	return s, w
+}
+
+// displayWidth は文字列を端末に表示したときの幅を返す
+// エスケープシーケンスは幅に含めない
+func displayWidth(s string) int {
+	w := 0
+	inEscape := false
+	for _, c := range s {
+		switch {
+		case c == '\x1b':
+			inEscape = true
+		case inEscape:
+			if c == 'm' {
+				inEscape = false
+			}
+		default:
+			w += runeWidth(c)
+		}
+	}
+	return w
+}
+
+// runeWidth は1文字を端末に表示したときの幅を返す
+// 日本語などの全角文字は2、それ以外は1とする
+func runeWidth(c rune) int {
+	switch {
+	case unicode.In(c, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+		return 2
+	case c >= 0x3000 && c <= 0x303f, // 全角の句読点・括弧
+		c >= 0xff01 && c <= 0xff60, // 全角英数字・記号
+		c >= 0xffe0 && c <= 0xffe6:
+		return 2
+	default:
+		return 1
+	}
+}
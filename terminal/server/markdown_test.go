@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		width int
+		want  string
+	}{
+		{name: "heading and paragraph", src: "# Title\n\nHello **world**.", width: 40, want: "Title\n\nHello world."},
+		{name: "setext headings", src: "Title\n=====\nSub\n---", width: 40, want: "Title\n\nSub"},
+		{name: "lists", src: "- a\n- b\n  - c\n1. one\n2) two", width: 40, want: "  • a\n  • b\n    • c\n  1. one\n  2. two"},
+		{name: "list continuation", src: "- first\n  continued", width: 40, want: "  • first continued"},
+		{name: "quote", src: "> quoted\n> text", width: 40, want: "│ quoted text"},
+		{name: "code block", src: "```go\nfunc main() {\n\treturn\n}\n```", width: 10, want: "  func main() {\n      return\n  }"},
+		{name: "rule", src: "***", width: 20, want: strings.Repeat("─", 20)},
+		{name: "inline", src: "*em* ~~del~~ `code`", width: 40, want: "em del code"},
+		{name: "link", src: "[site](https://example.com)", width: 40, want: "site (https://example.com)"},
+		{name: "autolink", src: "<https://example.com>", width: 40, want: "https://example.com"},
+		{name: "crlf", src: "a\r\nb", width: 40, want: "a b"},
+		{name: "wrap words", src: "The quick brown fox jumps over the lazy dog", width: 20, want: "The quick brown fox\njumps over the lazy\ndog"},
+		{name: "wrap long word", src: "abcdefghijklmnopqrstuvwxyz", width: 20, want: "abcdefghijklmnopqrst\nuvwxyz"},
+		{name: "wrap list item", src: "- long item text that needs to wrap", width: 20, want: "  • long item text\n    that needs to\n    wrap"},
+		{name: "punctuation after code", src: "Hello world and `code`.", width: 20, want: "Hello world and\ncode."},
+		{name: "word across emphasis", src: "aaaaaaaaaaaaaaa **bold**text", width: 20, want: "aaaaaaaaaaaaaaa\nboldtext"},
+		{name: "join japanese lines", src: "日本語の文章です。\n続きです。", width: 40, want: "日本語の文章です。続きです。"},
+		{name: "kinsoku", src: "これは折り返しのテストです。句読点", width: 20, want: "これは折り返しのテス\nトです。句読点"},
+		{name: "kinsoku punctuation", src: "あいうえおかきくけこ。", width: 20, want: "あいうえおかきくけ\nこ。"},
+		{name: "kinsoku across emphasis", src: "あいうえおかきくけ**こ**。", width: 20, want: "あいうえおかきくけ\nこ。"},
+		{name: "opening bracket", src: "あいうえおかきく「け」", width: 20, want: "あいうえおかきく\n「け」"},
+		{name: "minimum width", src: "The quick brown fox jumps", width: 5, want: "The quick brown fox\njumps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderMarkdown(tt.src, tt.width, false); got != tt.want {
+				t.Errorf("renderMarkdown(%q, %d) = %q, want %q", tt.src, tt.width, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderMarkdownColor(t *testing.T) {
+	got := renderMarkdown("**bold** [x](https://e.com)", 40, true)
+	want := ansiBold + "bold" + ansiReset + " " +
+		hyperlink("https://e.com", ansiUnderline+ansiBlue+"x"+ansiReset) +
+		ansiDim + " (https://e.com)" + ansiReset
+	if got != want {
+		t.Errorf("renderMarkdown() = %q, want %q", got, want)
+	}
+
+	// 折り返した行ごとに装飾を付け直す
+	got = renderMarkdown("**aaaa bbbb**", 20, true)
+	if want := ansiBold + "aaaa bbbb" + ansiReset; got != want {
+		t.Errorf("renderMarkdown() = %q, want %q", got, want)
+	}
+	got = renderMarkdown("**aaaaaaaaaa bbbbbbbbbb**", 20, true)
+	if want := ansiBold + "aaaaaaaaaa" + ansiReset + "\n" + ansiBold + "bbbbbbbbbb" + ansiReset; got != want {
+		t.Errorf("renderMarkdown() = %q, want %q", got, want)
+	}
+}
+
+func TestDisplayWidth(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{s: "", want: 0},
+		{s: "abc", want: 3},
+		{s: "日本語", want: 6},
+		{s: "（テスト）", want: 10},
+		{s: "ＡＢ", want: 4},
+		{s: "\x1b[1mbold\x1b[0m", want: 4},
+	}
+	for _, tt := range tests {
+		if got := displayWidth(tt.s); got != tt.want {
+			t.Errorf("displayWidth(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
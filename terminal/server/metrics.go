@@ -0,0 +1,93 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheusのメトリクス
+// コマンドの処理フロー（mainの受信ループ・decodeMessage・processPayload・executeCommand・runBuiltin）とDispatcher、SessionManager、RedisTransportから更新する
+var (
+	// 受信したコマンドの数
+	commandsReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "terminal",
+		Name:      "commands_received_total",
+		Help:      "受信したコマンドの数",
+	})
+	// 実行したコマンドの数（実行結果の成否は問わない）
+	commandsExecuted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "terminal",
+		Name:      "commands_executed_total",
+		Help:      "実行したコマンドの数",
+	})
+	// 実行前・実行後の検証で拒否したコマンドの数
+	commandsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "terminal",
+		Name:      "commands_rejected_total",
+		Help:      "拒否したコマンドの数",
+	}, []string{"reason"})
+	// 実行に失敗したコマンドの数
+	commandsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "terminal",
+		Name:      "commands_failed_total",
+		Help:      "実行に失敗したコマンドの数",
+	}, []string{"reason"})
+	// コマンドの実行時間
+	commandDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "terminal",
+		Name:      "command_duration_seconds",
+		Help:      "コマンドの実行時間（秒）",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	})
+	// コマンドの出力サイズ
+	commandOutputBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "terminal",
+		Name:      "command_output_bytes",
+		Help:      "コマンドの出力サイズ（バイト）",
+		Buckets:   prometheus.ExponentialBuckets(16, 4, 8), // 16B〜256KB
+	})
+	// 作成したセッションの数
+	sessionsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "terminal",
+		Name:      "sessions_created_total",
+		Help:      "作成したセッションの数",
+	})
+	// 現在のセッション数
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "terminal",
+		Name:      "sessions_active",
+		Help:      "現在のセッション数",
+	}, func() float64 {
+		return float64(sessionManager.Count())
+	})
+	// Redisへの再接続の回数
+	redisReconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "terminal",
+		Name:      "redis_reconnects_total",
+		Help:      "Redisへの再接続の回数",
+	})
+	// Redisへの結果の送信に失敗した回数
+	redisPublishFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "terminal",
+		Name:      "redis_publish_failures_total",
+		Help:      "Redisへの結果の送信に失敗した回数",
+	})
+)
+
+// 拒否・失敗の理由（reasonラベルの値）
+const (
+	reasonParseError    = "parse_error"    // メッセージのパースに失敗
+	reasonValidation    = "validation"     // コマンドのバリデーションエラー（ポリシー違反など）
+	reasonInvalidResult = "invalid_result" // 実行結果のバリデーションエラー（出力が大きすぎるなど）
+	reasonSessionError  = "session_error"  // セッションの取得・作成に失敗
+	reasonExitStatus    = "exit_status"    // コマンドが0以外の終了コードで終了
+	reasonTimeout       = "timeout"        // コマンドがタイムアウト
+	reasonCanceled      = "canceled"       // シャットダウンによる強制終了
+	reasonBuiltin       = "builtin"        // ビルトインコマンドのエラー（cdでディレクトリが存在しないなど）
+	reasonMaintenance   = "maintenance"    // メンテナンスモード中のため拒否
+	reasonHistory       = "history"        // 履歴の参照に失敗（!nの番号が存在しないなど）
+	reasonKilled        = "killed"         // 管理APIからのセッション終了による強制終了
+	reasonInterrupted   = "interrupted"    // クライアントからの中断（Ctrl-C）
+	reasonNotFound      = "not_found"      // 仮想ファイルシステムモードでビルトインコマンド以外を実行しようとした
+	reasonPanic         = "panic"          // コマンドの処理中にpanicした
+)
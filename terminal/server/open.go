@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+func init() {
+	builtins.Register(openBuiltin{})
+}
+
+// openBuiltin は、リンクをブラウザの新しいタブで開くコマンド
+// 開くURLは結果の操作（open_url）としてフロントエンドに渡し、出力にはリンクを表示する
+type openBuiltin struct{}
+
+func (openBuiltin) Name() string               { return "open" }
+func (openBuiltin) Usage() string              { return "open [名前 | URL ...]" }
+func (openBuiltin) Help() string               { return "リンクをブラウザの新しいタブで開きます" }
+func (openBuiltin) Completion() completionKind { return completeNone }
+
+func (openBuiltin) Examples() []string {
+	return []string{"open", "open github", "open https://github.com/nose221834/HP"}
+}
+
+func (openBuiltin) Options() []CommandOption { return nil }
+
+// Run は名前（links.json）またはURLで指定したリンクを開く
+// 引数を指定しない場合は、名前で開けるリンクを一覧表示する
+func (openBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	_, noColor := session.env["NO_COLOR"]
+	link := func(u string) string {
+		if noColor {
+			return u
+		}
+		return hyperlink(u, u)
+	}
+
+	if len(args) == 0 {
+		names := sortedKeys(links)
+		width := 0
+		for _, name := range names {
+			width = max(width, len(name))
+		}
+		lines := make([]string, 0, len(names))
+		for _, name := range names {
+			lines = append(lines, fmt.Sprintf("%-*s  %s", width, name, link(links[name])))
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+
+	var lines []string
+	for _, arg := range args {
+		u, ok := links[arg]
+		if !ok {
+			if !strings.Contains(arg, "://") {
+				return strings.Join(lines, "\n"), newMessageError("open.not_found", param("name", arg))
+			}
+			u = arg
+		}
+		if err := emitAction(ctx, Action{Type: ActionOpenURL, URL: u}); err != nil {
+			return strings.Join(lines, "\n"), newMessageError("error.command", param("command", "open"), err)
+		}
+		lines = append(lines, localize(ctx, "open.opening", link(u)))
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// startOpsServers はメトリクス・ヘルスチェック・管理APIを公開するHTTPサーバーを起動する
+// 待ち受けアドレスが同じ場合は1つのサーバーで公開する
+func startOpsServers(d *Dispatcher, transport Transport) []*http.Server {
+	muxes := make(map[string]*http.ServeMux)
+	muxFor := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+
+	if cfg.MetricsListen != "" {
+		muxFor(cfg.MetricsListen).Handle(cfg.MetricsPath, promhttp.Handler())
+	}
+	if cfg.HealthListen != "" {
+		mux := muxFor(cfg.HealthListen)
+		mux.Handle("/healthz", newHealthHandler(livenessChecks(d)))
+		mux.Handle("/readyz", newHealthHandler(readinessChecks(d, transport)))
+	}
+	if cfg.AdminListen != "" {
+		muxFor(cfg.AdminListen).Handle("/admin/", newAdminHandler(sessionManager, transport, cfg.AdminToken))
+	}
+
+	var servers []*http.Server
+	for addr, mux := range muxes {
+		server := &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			slog.Info("運用サーバーを起動", "addr", addr)
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("運用サーバーエラー", "error", err, "addr", addr)
+			}
+		}()
+		servers = append(servers, server)
+	}
+	return servers
+}
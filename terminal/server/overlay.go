@@ -0,0 +1,334 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 書き込みで返すエラー
+var (
+	errReadOnly = errors.New("読み取り専用のファイルシステムです")
+	errExist    = errors.New("ファイルが既に存在します")
+)
+
+// quotaError は、セッションの書き込みの上限を超えた場合のエラー
+type quotaError struct {
+	kind  string // 上限の種類（files: ファイル数 / bytes: 容量）
+	limit int    // 上限値
+}
+
+// Error は言語によらない代替のメッセージを返す
+// 結果に含めるメッセージは、localizeError（fsErrorMessage）でセッションの言語に変換する
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("%s quota exceeded (limit %d)", e.kind, e.limit)
+}
+
+// WritableFileSystem は、書き込みができるFileSystem
+// 書き込みのビルトインコマンド（touch・mkdir・rm・リダイレクト）が使用する
+type WritableFileSystem interface {
+	FileSystem
+	// WriteFile はファイルに書き込む。appendDataの場合は末尾に追加する
+	WriteFile(name string, data []byte, appendData bool) error
+	// Touch はファイルが存在しない場合は空のファイルを作成し、存在する場合は更新日時を更新する
+	Touch(name string) error
+	// Mkdir はディレクトリを作成する
+	Mkdir(name string) error
+	// Remove はファイルを削除する。recursiveの場合はディレクトリを中身ごと削除する
+	Remove(name string, recursive bool) error
+}
+
+// OverlayEntry は、セッションで書き込んだファイル・ディレクトリ1件
+type OverlayEntry struct {
+	Dir     bool      `json:"dir,omitempty"`     // ディレクトリかどうか
+	Deleted bool      `json:"deleted,omitempty"` // 元のファイルを削除したことを表す印
+	Data    []byte    `json:"data,omitempty"`    // ファイルの内容
+	ModTime time.Time `json:"mod_time"`          // 更新日時
+}
+
+// Overlay は、セッションごとの書き込みを保持する構造体
+// 仮想ファイルシステムの上に重ねて参照し、元のファイルは変更しない
+// セッションのロックを保持した状態で使用する
+type Overlay struct {
+	Entries map[string]*OverlayEntry `json:"entries"` // 絶対パスをキーとする書き込み
+
+	dirty bool // 保存してから変更したかどうか
+}
+
+// newOverlay は空のOverlayを作成
+func newOverlay() *Overlay {
+	return &Overlay{Entries: make(map[string]*OverlayEntry)}
+}
+
+// usage は書き込んだファイル数（ディレクトリを含み、削除の印は含まない）と容量（バイト）を返す
+func (o *Overlay) usage() (files, bytes int) {
+	for _, e := range o.Entries {
+		if !e.Deleted {
+			files++
+		}
+		bytes += len(e.Data)
+	}
+	return files, bytes
+}
+
+// overlayFS は、仮想ファイルシステムにセッションの書き込みを重ねたWritableFileSystem
+// 書き込めるのはホームディレクトリ以下のみで、ファイル数と容量の上限を超える書き込みはエラーにする
+type overlayFS struct {
+	base    FileSystem // 元のファイルシステム（読み取り専用）
+	overlay *Overlay   // セッションの書き込み
+	owner   string     // 書き込んだファイルの所有者
+}
+
+// entry はパスに対応する書き込みと、元のファイルシステムを参照するかどうかを返す
+// 途中のディレクトリを削除・作成している場合は、それ以下の元のファイルを参照しない
+func (o *overlayFS) entry(name string) (e *OverlayEntry, useBase bool) {
+	if e, ok := o.overlay.Entries[name]; ok {
+		return e, false
+	}
+	for dir := path.Dir(name); dir != "/"; dir = path.Dir(dir) {
+		if parent, ok := o.overlay.Entries[dir]; ok {
+			if parent.Deleted {
+				return parent, false
+			}
+			return nil, false
+		}
+	}
+	return nil, true
+}
+
+// fileInfo は書き込んだファイルの情報を返す
+func (o *overlayFS) fileInfo(name string, e *OverlayEntry) fs.FileInfo {
+	mode := fs.FileMode(0o644)
+	if e.Dir {
+		mode = fs.ModeDir | 0o755
+	}
+	return &overlayFileInfo{name: path.Base(name), entry: e, mode: mode, owner: o.owner}
+}
+
+// Stat はファイルの情報を返す
+func (o *overlayFS) Stat(name string) (fs.FileInfo, error) {
+	name = path.Clean(name)
+	e, useBase := o.entry(name)
+	switch {
+	case e != nil && e.Deleted, e == nil && !useBase:
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	case e != nil:
+		return o.fileInfo(name, e), nil
+	}
+	return o.base.Stat(name)
+}
+
+// ReadDir はディレクトリの内容を名前順に返す
+// 元のディレクトリの内容に、書き込んだファイルを追加・削除して返す
+func (o *overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	name = path.Clean(name)
+	info, err := o.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+
+	entries := make(map[string]fs.DirEntry)
+	if _, useBase := o.entry(name); useBase {
+		base, err := o.base.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range base {
+			entries[entry.Name()] = entry
+		}
+	}
+	for p, e := range o.overlay.Entries {
+		if p == name || path.Dir(p) != name {
+			continue
+		}
+		if e.Deleted {
+			delete(entries, path.Base(p))
+		} else {
+			entries[path.Base(p)] = fs.FileInfoToDirEntry(o.fileInfo(p, e))
+		}
+	}
+
+	result := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+	return result, nil
+}
+
+// ReadFile はファイルの内容を返す
+func (o *overlayFS) ReadFile(name string) ([]byte, error) {
+	name = path.Clean(name)
+	e, useBase := o.entry(name)
+	switch {
+	case e != nil && e.Deleted, e == nil && !useBase:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case e != nil && e.Dir:
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDir}
+	case e != nil:
+		return append([]byte(nil), e.Data...), nil
+	}
+	return o.base.ReadFile(name)
+}
+
+// Chdir は作業ディレクトリにできるかどうかを確認する
+func (o *overlayFS) Chdir(name string) error {
+	name = path.Clean(name)
+	e, useBase := o.entry(name)
+	switch {
+	case e != nil && e.Deleted, e == nil && !useBase:
+		return &fs.PathError{Op: "chdir", Path: name, Err: fs.ErrNotExist}
+	case e != nil && !e.Dir:
+		return &fs.PathError{Op: "chdir", Path: name, Err: errNotDir}
+	case e != nil:
+		return nil
+	}
+	return o.base.Chdir(name)
+}
+
+// writable は書き込めるパスかどうかを確認する
+// ホームディレクトリ以下で、親ディレクトリが存在する場合のみ書き込める
+func (o *overlayFS) writable(op, name string) error {
+	home := path.Clean(cfg.HomeDir)
+	if !strings.HasPrefix(name, home+"/") {
+		return &fs.PathError{Op: op, Path: name, Err: errReadOnly}
+	}
+	if err := o.Chdir(path.Dir(name)); err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: fsCause(err)}
+	}
+	return nil
+}
+
+// put は書き込みを追加し、上限を超える場合はエラーを返す
+func (o *overlayFS) put(op, name string, e *OverlayEntry) error {
+	files, bytes := o.overlay.usage()
+	if old, ok := o.overlay.Entries[name]; ok {
+		if !old.Deleted {
+			files--
+		}
+		bytes -= len(old.Data)
+	}
+	// 削除の印はファイル数に含めず、上限に達していても元のファイルを削除できるようにする
+	if cfg.OverlayMaxFiles > 0 && !e.Deleted && files+1 > cfg.OverlayMaxFiles {
+		return &fs.PathError{Op: op, Path: name, Err: &quotaError{kind: "files", limit: cfg.OverlayMaxFiles}}
+	}
+	if cfg.OverlayMaxBytes > 0 && bytes+len(e.Data) > cfg.OverlayMaxBytes {
+		return &fs.PathError{Op: op, Path: name, Err: &quotaError{kind: "bytes", limit: cfg.OverlayMaxBytes}}
+	}
+	o.overlay.Entries[name] = e
+	o.overlay.dirty = true
+	return nil
+}
+
+// WriteFile はファイルに書き込む。appendDataの場合は末尾に追加する
+// 元のファイルに書き込む場合は、内容をコピーしてから変更する
+func (o *overlayFS) WriteFile(name string, data []byte, appendData bool) error {
+	name = path.Clean(name)
+	if err := o.writable("write", name); err != nil {
+		return err
+	}
+	old, err := o.ReadFile(name)
+	switch {
+	case errors.Is(err, errIsDir):
+		return &fs.PathError{Op: "write", Path: name, Err: errIsDir}
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	if appendData {
+		data = append(old, data...)
+	}
+	return o.put("write", name, &OverlayEntry{Data: data, ModTime: time.Now()})
+}
+
+// Touch はファイルが存在しない場合は空のファイルを作成し、存在する場合は更新日時を更新する
+// 元のファイルの更新日時は変更しない
+func (o *overlayFS) Touch(name string) error {
+	name = path.Clean(name)
+	if _, err := o.Stat(name); err == nil {
+		if e, ok := o.overlay.Entries[name]; ok {
+			e.ModTime = time.Now()
+			o.overlay.dirty = true
+		}
+		return nil
+	}
+	if err := o.writable("touch", name); err != nil {
+		return err
+	}
+	return o.put("touch", name, &OverlayEntry{ModTime: time.Now()})
+}
+
+// Mkdir はディレクトリを作成する
+func (o *overlayFS) Mkdir(name string) error {
+	name = path.Clean(name)
+	if _, err := o.Stat(name); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: errExist}
+	}
+	if err := o.writable("mkdir", name); err != nil {
+		return err
+	}
+	return o.put("mkdir", name, &OverlayEntry{Dir: true, ModTime: time.Now()})
+}
+
+// Remove はファイルを削除する。recursiveの場合はディレクトリを中身ごと削除する
+// 元のファイルを削除する場合は、削除したことを表す印を書き込む
+func (o *overlayFS) Remove(name string, recursive bool) error {
+	name = path.Clean(name)
+	info, err := o.Stat(name)
+	if err != nil {
+		return err
+	}
+	if err := o.writable("remove", name); err != nil {
+		return err
+	}
+	if info.IsDir() && !recursive {
+		return &fs.PathError{Op: "remove", Path: name, Err: errIsDir}
+	}
+
+	// 配下の書き込みは不要になるため削除する
+	for p := range o.overlay.Entries {
+		if strings.HasPrefix(p, name+"/") {
+			delete(o.overlay.Entries, p)
+		}
+	}
+	delete(o.overlay.Entries, name)
+	o.overlay.dirty = true
+
+	// 元のファイルが残っている場合は、削除したことを表す印で隠す
+	if _, err := o.Stat(name); err == nil {
+		return o.put("remove", name, &OverlayEntry{Deleted: true, ModTime: time.Now()})
+	}
+	return nil
+}
+
+// fsCause はPathErrorの原因のエラーを返す
+func fsCause(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	return err
+}
+
+// overlayFileInfo は、セッションで書き込んだファイルの情報
+type overlayFileInfo struct {
+	name  string
+	entry *OverlayEntry
+	mode  fs.FileMode
+	owner string
+}
+
+func (i *overlayFileInfo) Name() string       { return i.name }
+func (i *overlayFileInfo) Size() int64        { return int64(len(i.entry.Data)) }
+func (i *overlayFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i *overlayFileInfo) ModTime() time.Time { return i.entry.ModTime }
+func (i *overlayFileInfo) IsDir() bool        { return i.entry.Dir }
+func (i *overlayFileInfo) Sys() any           { return nil }
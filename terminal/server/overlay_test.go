@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestOverlayFS は、一時ディレクトリをホームディレクトリとする書き込みのファイルシステムを作成する
+// 元のファイルシステムには base.txt と dir/inner.txt を置く
+func newTestOverlayFS(t *testing.T, maxFiles, maxBytes int) (*overlayFS, string) {
+	t.Helper()
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"base.txt", "dir/inner.txt"} {
+		if err := os.WriteFile(filepath.Join(home, name), []byte("base"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.HomeDir = home
+	cfg.OverlayMaxFiles = maxFiles
+	cfg.OverlayMaxBytes = maxBytes
+	return &overlayFS{base: hostFS{}, overlay: newOverlay(), owner: "guest"}, home
+}
+
+func TestOverlayQuota(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxFiles int
+		maxBytes int
+		ops      func(o *overlayFS, home string) error
+		want     error // 最後の操作のエラー（nilの場合は成功）
+	}{
+		{
+			name:     "files within limit",
+			maxFiles: 2,
+			ops: func(o *overlayFS, home string) error {
+				if err := o.Touch(home + "/a"); err != nil {
+					return err
+				}
+				return o.Mkdir(home + "/b")
+			},
+		},
+		{
+			name:     "files over limit",
+			maxFiles: 1,
+			ops: func(o *overlayFS, home string) error {
+				if err := o.Touch(home + "/a"); err != nil {
+					return err
+				}
+				return o.Touch(home + "/b")
+			},
+			want: &quotaError{kind: "files", limit: 1},
+		},
+		{
+			name:     "overwrite does not count twice",
+			maxFiles: 1,
+			ops: func(o *overlayFS, home string) error {
+				if err := o.WriteFile(home+"/a", []byte("1"), false); err != nil {
+					return err
+				}
+				return o.WriteFile(home+"/a", []byte("2"), true)
+			},
+		},
+		{
+			name:     "bytes over limit",
+			maxBytes: 4,
+			ops: func(o *overlayFS, home string) error {
+				if err := o.WriteFile(home+"/a", []byte("12"), false); err != nil {
+					return err
+				}
+				return o.WriteFile(home+"/a", []byte("345"), true)
+			},
+			want: &quotaError{kind: "bytes", limit: 4},
+		},
+		{
+			name:     "remove base file at the file limit",
+			maxFiles: 1,
+			ops: func(o *overlayFS, home string) error {
+				if err := o.Touch(home + "/a"); err != nil {
+					return err
+				}
+				return o.Remove(home+"/base.txt", false)
+			},
+		},
+		{
+			name:     "whiteouts do not use the file limit",
+			maxFiles: 1,
+			ops: func(o *overlayFS, home string) error {
+				if err := o.Remove(home+"/base.txt", false); err != nil {
+					return err
+				}
+				if err := o.Remove(home+"/dir", true); err != nil {
+					return err
+				}
+				return o.Touch(home + "/a")
+			},
+		},
+		{
+			name:     "recreate a removed base file",
+			maxFiles: 1,
+			ops: func(o *overlayFS, home string) error {
+				if err := o.Remove(home+"/base.txt", false); err != nil {
+					return err
+				}
+				return o.WriteFile(home+"/base.txt", []byte("new"), false)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, home := newTestOverlayFS(t, tt.maxFiles, tt.maxBytes)
+			err := tt.ops(o, home)
+			var quota *quotaError
+			switch {
+			case tt.want == nil && err != nil:
+				t.Fatalf("error = %v, want nil", err)
+			case tt.want != nil && (!errors.As(err, &quota) || *quota != *tt.want.(*quotaError)):
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverlayWhiteout(t *testing.T) {
+	o, home := newTestOverlayFS(t, 0, 0)
+
+	if err := o.Remove(home+"/dir", false); !errors.Is(err, errIsDir) {
+		t.Errorf("Remove(dir) = %v, want %v", err, errIsDir)
+	}
+	if err := o.Remove(home+"/dir", true); err != nil {
+		t.Fatalf("Remove(dir, recursive) = %v", err)
+	}
+	for _, name := range []string{"/dir", "/dir/inner.txt"} {
+		if _, err := o.Stat(home + name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(%s) after remove = %v, want not exist", name, err)
+		}
+	}
+	entries, err := o.ReadDir(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "base.txt" {
+		t.Errorf("ReadDir(home) = %v, want only base.txt", entries)
+	}
+
+	// 削除したディレクトリを作り直しても、元のファイルは見えない
+	if err := o.Mkdir(home + "/dir"); err != nil {
+		t.Fatalf("Mkdir(dir) = %v", err)
+	}
+	if _, err := o.Stat(home + "/dir/inner.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(dir/inner.txt) after mkdir = %v, want not exist", err)
+	}
+
+	// 書き込んだファイルの削除は印を残さない
+	if err := o.Touch(home + "/new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Remove(home+"/new", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := o.overlay.Entries[home+"/new"]; ok {
+		t.Errorf("removing a written file left an entry")
+	}
+	if files, _ := o.overlay.usage(); files != 1 {
+		t.Errorf("usage() files = %d, want 1 (the recreated directory)", files)
+	}
+
+	// 元のファイルシステムは変更しない
+	if _, err := os.Stat(filepath.Join(home, "dir", "inner.txt")); err != nil {
+		t.Errorf("base file changed: %v", err)
+	}
+	if err := o.Touch("/tmp/outside"); !errors.Is(err, errReadOnly) {
+		t.Errorf("Touch outside home = %v, want %v", err, errReadOnly)
+	}
+}
+
+func TestCutRedirect(t *testing.T) {
+	tests := []struct {
+		line       string
+		wantLine   string
+		wantTarget string // 空の場合はリダイレクトなし
+		wantAppend bool
+		wantErr    bool
+	}{
+		{line: "echo hi", wantLine: "echo hi"},
+		{line: "echo hi > out.txt", wantLine: "echo hi ", wantTarget: "out.txt"},
+		{line: "echo hi>>out.txt", wantLine: "echo hi", wantTarget: "out.txt", wantAppend: true},
+		{line: `echo hi > "my file"`, wantLine: "echo hi ", wantTarget: "my file"},
+		{line: `echo "a > b"`, wantLine: `echo "a > b"`},
+		{line: `echo 'a > b'`, wantLine: `echo 'a > b'`},
+		{line: `echo a \> b`, wantLine: `echo a \> b`},
+		{line: `echo "\"" > out`, wantLine: `echo "\"" `, wantTarget: "out"},
+		{line: "echo hi >", wantErr: true},
+		{line: "echo hi > a b", wantErr: true},
+		{line: `echo hi > "a`, wantErr: true},
+	}
+	for _, tt := range tests {
+		line, redirect, err := cutRedirect(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("cutRedirect(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if line != tt.wantLine {
+			t.Errorf("cutRedirect(%q) line = %q, want %q", tt.line, line, tt.wantLine)
+		}
+		switch {
+		case tt.wantTarget == "" && redirect != nil:
+			t.Errorf("cutRedirect(%q) redirect = %+v, want nil", tt.line, redirect)
+		case tt.wantTarget != "" && (redirect == nil || redirect.target != tt.wantTarget || redirect.appendData != tt.wantAppend):
+			t.Errorf("cutRedirect(%q) redirect = %+v, want %q append %v", tt.line, redirect, tt.wantTarget, tt.wantAppend)
+		}
+	}
+}
+
+// TestWriteErrorsLocalized は、書き込みのビルトインコマンドのエラーがセッションの言語で表示されることを確認する
+func TestWriteErrorsLocalized(t *testing.T) {
+	o, home := newTestOverlayFS(t, 1, 0)
+	ctx := withLocale(context.Background(), "en")
+	tests := []struct {
+		name    string
+		overlay *Overlay // nilの場合は書き込みできない
+		run     func(session *Session) error
+		want    string
+	}{
+		{
+			name: "touch read-only",
+			run: func(session *Session) error {
+				_, err := touchBuiltin{}.Run(ctx, session, []string{"a"})
+				return err
+			},
+			want: "touch: Read-only file system",
+		},
+		{
+			name: "mkdir read-only",
+			run: func(session *Session) error {
+				_, err := mkdirBuiltin{}.Run(ctx, session, []string{"a"})
+				return err
+			},
+			want: "mkdir: Read-only file system",
+		},
+		{
+			name: "rm read-only",
+			run: func(session *Session) error {
+				_, err := rmBuiltin{}.Run(ctx, session, []string{"base.txt"})
+				return err
+			},
+			want: "rm: Read-only file system",
+		},
+		{
+			name: "redirect read-only",
+			run: func(session *Session) error {
+				return (&outputRedirect{target: "a"}).write(session, "x")
+			},
+			want: "Read-only file system",
+		},
+		{
+			name:    "touch quota",
+			overlay: o.overlay,
+			run: func(session *Session) error {
+				_, err := touchBuiltin{}.Run(ctx, session, []string{"a", "b"})
+				return err
+			},
+			want: "touch: b: File count limit (1) exceeded",
+		},
+		{
+			name:    "mkdir exists",
+			overlay: o.overlay,
+			run: func(session *Session) error {
+				_, err := mkdirBuiltin{}.Run(ctx, session, []string{"dir"})
+				return err
+			},
+			want: "mkdir: dir: File exists",
+		},
+		{
+			name:    "rm directory",
+			overlay: o.overlay,
+			run: func(session *Session) error {
+				_, err := rmBuiltin{}.Run(ctx, session, []string{"dir"})
+				return err
+			},
+			want: "rm: dir: Is a directory",
+		},
+		{
+			name:    "redirect quota",
+			overlay: o.overlay,
+			run: func(session *Session) error {
+				return (&outputRedirect{target: "c"}).write(session, "x")
+			},
+			want: "File count limit (1) exceeded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := &Session{CurrentDir: home, Username: "guest", overlay: tt.overlay}
+			err := tt.run(session)
+			if err == nil {
+				t.Fatal("error = nil")
+			}
+			if got := localizeError("en", err); got != tt.want {
+				t.Errorf("localizeError(en) = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// 言語に変換されなかった場合の代替のメッセージも、特定の言語に依存しない
+	if got, want := (&quotaError{kind: "bytes", limit: 10}).Error(), "bytes quota exceeded (limit 10)"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// セッションの書き込みを保存するキーの接頭辞
+const overlayKeyPrefix = "terminal:overlay:"
+
+// OverlayStore は、セッションの書き込み（Overlay）を保存するインターフェース
+type OverlayStore interface {
+	// Load は保存された書き込みを読み込む
+	// 保存されていない場合はnilを返す
+	Load(ctx context.Context, sessionID string) (*Overlay, error)
+	// Save は書き込みを保存する
+	Save(ctx context.Context, sessionID string, overlay *Overlay) error
+	// Delete は保存された書き込みを削除する
+	Delete(ctx context.Context, sessionID string) error
+	// Close はストアが保持する接続を閉じる
+	Close() error
+}
+
+// RedisOverlayStore は、セッションの書き込みをRedisに保存するOverlayStore
+// 保存・読み込みのたびに有効期限を延長し、一定期間使われなかった書き込みは自動的に削除される
+type RedisOverlayStore struct {
+	rdb redis.UniversalClient
+	ttl time.Duration // 書き込みの有効期限（0の場合は無期限）
+}
+
+// NewRedisOverlayStore は新しいRedisOverlayStoreを作成
+func NewRedisOverlayStore(rc RedisConfig, ttl time.Duration) (*RedisOverlayStore, error) {
+	rdb, err := newRedisClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisOverlayStore{rdb: rdb, ttl: ttl}, nil
+}
+
+// Load は保存された書き込みを読み込み、有効期限を延長する
+func (s *RedisOverlayStore) Load(ctx context.Context, sessionID string) (*Overlay, error) {
+	ctx, span := tracer.Start(ctx, "overlay.load")
+	defer span.End()
+
+	data, err := s.rdb.Get(ctx, overlayKeyPrefix+sessionID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		recordSpanError(span, err)
+		return nil, fmt.Errorf("書き込みの読み込みエラー: %w", err)
+	}
+
+	overlay := newOverlay()
+	if err := json.Unmarshal(data, overlay); err != nil {
+		recordSpanError(span, err)
+		return nil, fmt.Errorf("書き込みのパースエラー: %w", err)
+	}
+	if overlay.Entries == nil {
+		overlay.Entries = make(map[string]*OverlayEntry)
+	}
+	if s.ttl > 0 {
+		s.rdb.Expire(ctx, overlayKeyPrefix+sessionID, s.ttl)
+	}
+	return overlay, nil
+}
+
+// Save は書き込みを保存する
+func (s *RedisOverlayStore) Save(ctx context.Context, sessionID string, overlay *Overlay) error {
+	ctx, span := tracer.Start(ctx, "overlay.save")
+	defer span.End()
+
+	data, err := json.Marshal(overlay)
+	if err != nil {
+		return err
+	}
+	if err := s.rdb.Set(ctx, overlayKeyPrefix+sessionID, data, s.ttl).Err(); err != nil {
+		recordSpanError(span, err)
+		return fmt.Errorf("書き込みの保存エラー: %w", err)
+	}
+	return nil
+}
+
+// Delete は保存された書き込みを削除する
+func (s *RedisOverlayStore) Delete(ctx context.Context, sessionID string) error {
+	if err := s.rdb.Del(ctx, overlayKeyPrefix+sessionID).Err(); err != nil {
+		return fmt.Errorf("書き込みの削除エラー: %w", err)
+	}
+	return nil
+}
+
+// Close はRedisとの接続を閉じる
+func (s *RedisOverlayStore) Close() error {
+	return s.rdb.Close()
+}
+
+// newOverlayStore は名前に対応するOverlayStoreを作成
+// off・memoryの場合は保存しない（nilを返す）
+func newOverlayStore(name string) (OverlayStore, error) {
+	switch name {
+	case "off", "memory":
+		return nil, nil
+	case "redis":
+		return NewRedisOverlayStore(cfg.Redis, cfg.OverlayTTL)
+	default:
+		return nil, fmt.Errorf("不明な書き込みの保存先です: %s", name)
+	}
+}
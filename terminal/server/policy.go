@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Policy は、実行を許可・拒否するコマンドを定義する構造体
+// ポリシーファイル（JSON）から読み込む
+type Policy struct {
+	DeniedCommands  []string `json:"denied_commands"`  // 実行を拒否するコマンド
+	AllowedCommands []string `json:"allowed_commands"` // 実行を許可するコマンド（空の場合は拒否リスト以外すべて許可）
+}
+
+// 現在のポリシー（mainで読み込む）
+var policy = defaultPolicy()
+
+// defaultPolicy は組み込みのポリシーを返す
+func defaultPolicy() *Policy {
+	return &Policy{
+		DeniedCommands: []string{"rm", "shutdown"},
+	}
+}
+
+// LoadPolicy はポリシーファイルを読み込む
+// パスが空の場合は組み込みのポリシーを返す
+func LoadPolicy(path string) (*Policy, error) {
+	if path == "" {
+		return defaultPolicy(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ポリシーファイルの読み込みエラー: %w", err)
+	}
+
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("ポリシーファイルのパースエラー: %w", err)
+	}
+	return &p, nil
+}
+
+// Allows はコマンド名の実行が許可されているかどうかを返す
+func (p *Policy) Allows(baseCmd string) bool {
+	for _, denied := range p.DeniedCommands {
+		if baseCmd == denied {
+			return false
+		}
+	}
+	if len(p.AllowedCommands) == 0 {
+		return true
+	}
+	for _, allowed := range p.AllowedCommands {
+		if baseCmd == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// 録画ファイルに関する定数
+const (
+	recordingExt             = ".cast"       // 録画を終えたファイルの拡張子
+	recordingPartExt         = ".cast.part"  // 録画中のファイルの拡張子
+	recordingCleanupInterval = 1 * time.Hour // 保存期間を過ぎた録画を削除する間隔
+	recordingWidth           = 80            // 再生時の端末の幅
+	recordingHeight          = 24            // 再生時の端末の高さ
+)
+
+// ファイル名にそのまま使用できるセッションID
+var safeRecordingName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// asciicastHeader は、asciicast v2形式のヘッダー行
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// RecordingInfo は、管理APIで返す録画ファイルの情報
+type RecordingInfo struct {
+	Name    string    `json:"name"`     // ファイル名
+	Size    int64     `json:"size"`     // ファイルサイズ（バイト）
+	ModTime time.Time `json:"mod_time"` // 録画を終えた時刻
+}
+
+// Recorder は、セッションの操作をasciicast v2形式で記録する構造体
+// コマンドの出力は受け取った単位（チャンク）ごとに、経過時間とともに書き込む
+type Recorder struct {
+	mu        sync.Mutex
+	file      *os.File  // 書き込み中のファイル
+	path      string    // 録画を終えた後のファイルパス
+	start     time.Time // 録画の開始時刻（イベントの経過時間の基準）
+	size      int64     // 書き込んだサイズ（バイト）
+	maxSize   int64     // 録画の最大サイズ（0の場合は無制限）
+	truncated bool      // 最大サイズに達して記録を停止したかどうか
+	pending   []byte    // マルチバイト文字の途中で分割された出力
+}
+
+// newRecorder は新しい録画を開始する
+// 録画中は拡張子を .cast.part とし、Closeで .cast に変更する
+func newRecorder(dir, sessionID string, maxSize int64) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("録画ディレクトリの作成エラー: %w", err)
+	}
+
+	start := time.Now()
+	name := recordingName(sessionID, start)
+	file, err := os.OpenFile(filepath.Join(dir, name+recordingPartExt), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("録画ファイルの作成エラー: %w", err)
+	}
+
+	r := &Recorder{
+		file:    file,
+		path:    filepath.Join(dir, name+recordingExt),
+		start:   start,
+		maxSize: maxSize,
+	}
+	header, err := json.Marshal(asciicastHeader{
+		Version:   2,
+		Width:     recordingWidth,
+		Height:    recordingHeight,
+		Timestamp: start.Unix(),
+		Title:     "session " + sessionID,
+		Env:       map[string]string{"TERM": "xterm-256color", "SHELL": "/bin/bash"},
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := r.writeLine(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// recordingName はセッションIDと開始時刻から録画のファイル名（拡張子なし）を求める
+// ファイル名に使用できない文字を含むセッションIDはハッシュ値に置き換える
+func recordingName(sessionID string, start time.Time) string {
+	name := sessionID
+	if !safeRecordingName.MatchString(name) {
+		sum := sha256.Sum256([]byte(sessionID))
+		name = "session-" + hex.EncodeToString(sum[:8])
+	}
+	return name + "_" + start.UTC().Format("20060102T150405")
+}
+
+// Command は実行するコマンドをプロンプトとともに記録する
+func (r *Recorder) Command(username, cwd, cmd string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.event(fmt.Sprintf("\x1b[32m%s\x1b[0m:\x1b[34m%s\x1b[0m$ %s\n", username, cwd, cmd))
+}
+
+// Message はコマンドの出力以外のメッセージ（エラーなど）を記録する
+func (r *Recorder) Message(message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.flushPending()
+	r.event(message + "\n")
+}
+
+// Write はコマンドの出力を記録する
+// 記録に失敗してもコマンドの実行を妨げないよう、常に成功を返す
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// マルチバイト文字の途中で分割された場合は、続きを受け取るまで保留する
+	data := append(r.pending, p...)
+	r.pending = nil
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				r.pending = append([]byte(nil), data[i:]...)
+				data = data[:i]
+			}
+			break
+		}
+	}
+	if len(data) > 0 {
+		r.event(string(data))
+	}
+	return len(p), nil
+}
+
+// Close は録画を終了し、ファイル名を確定する
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.flushPending()
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(r.file.Name(), r.path)
+}
+
+// flushPending は保留している出力を書き込む
+func (r *Recorder) flushPending() {
+	if len(r.pending) > 0 {
+		r.event(string(r.pending))
+		r.pending = nil
+	}
+}
+
+// event は出力イベントを1行書き込む
+// 端末で再生できるよう改行はCRLFに変換する
+// 最大サイズを超える場合は、停止したことを記録して以降のイベントを破棄する
+func (r *Recorder) event(data string) {
+	if r.truncated {
+		return
+	}
+	line, err := json.Marshal([]any{time.Since(r.start).Seconds(), "o", strings.ReplaceAll(data, "\n", "\r\n")})
+	if err != nil {
+		return
+	}
+	if r.maxSize > 0 && r.size+int64(len(line))+1 > r.maxSize {
+		r.truncated = true
+		line, _ = json.Marshal([]any{time.Since(r.start).Seconds(), "o", "\r\n[録画サイズの上限に達したため記録を停止しました]\r\n"})
+	}
+	if err := r.writeLine(line); err != nil {
+		slog.Warn("録画の書き込みエラー", "error", err, "path", r.file.Name())
+		r.truncated = true
+	}
+}
+
+// writeLine は1行を書き込む
+func (r *Recorder) writeLine(line []byte) error {
+	n, err := r.file.Write(append(line, '\n'))
+	r.size += int64(n)
+	return err
+}
+
+// shouldRecord は設定とクライアントの指定から、セッションを録画するかどうかを判定する
+// requestedがnilの場合は現在の状態を維持する
+func shouldRecord(recording bool, requested *bool) bool {
+	switch cfg.RecordMode {
+	case "all":
+		// ポリシーにより全セッションを録画する（クライアントは停止できない）
+		return true
+	case "opt-in":
+		if requested != nil {
+			return *requested
+		}
+		return recording
+	default:
+		return false
+	}
+}
+
+// listRecordings は録画を終えたファイルの一覧を新しい順に返す
+func listRecordings(dir string) ([]RecordingInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []RecordingInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	recordings := []RecordingInfo{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), recordingExt) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		recordings = append(recordings, RecordingInfo{Name: entry.Name(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	sort.Slice(recordings, func(i, j int) bool {
+		return recordings[i].ModTime.After(recordings[j].ModTime)
+	})
+	return recordings, nil
+}
+
+// recordingPath は録画を終えたファイルのパスを返す
+// ディレクトリの外を指す名前や録画中のファイルは受け付けない
+func recordingPath(dir, name string) (string, bool) {
+	if name != filepath.Base(name) || !strings.HasSuffix(name, recordingExt) {
+		return "", false
+	}
+	return filepath.Join(dir, name), true
+}
+
+// cleanupRecordings は保存期間を過ぎた録画を削除する
+// 録画中のファイルは削除しない
+func cleanupRecordings(dir string, retention time.Duration) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("録画ディレクトリの読み込みエラー", "error", err, "dir", dir)
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), recordingExt) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if retention > 0 && time.Since(info.ModTime()) > retention {
+			if err := os.Remove(path); err != nil {
+				slog.Warn("録画の削除エラー", "error", err, "path", path)
+				continue
+			}
+			slog.Info("保存期間を過ぎた録画を削除", "path", path)
+		}
+	}
+}
+
+// recoverRecordings は前回の異常終了で残った録画中のファイルを、録画を終えたファイルとして扱う
+func recoverRecordings(dir string) {
+	parts, _ := filepath.Glob(filepath.Join(dir, "*"+recordingPartExt))
+	for _, part := range parts {
+		path := strings.TrimSuffix(part, recordingPartExt) + recordingExt
+		if err := os.Rename(part, path); err != nil {
+			slog.Warn("録画の復元エラー", "error", err, "path", part)
+		}
+	}
+}
+
+// startRecordingCleanup は保存期間を過ぎた録画を定期的に削除する
+// ctxがキャンセルされると停止する
+func startRecordingCleanup(ctx context.Context, dir string, retention time.Duration) {
+	recoverRecordings(dir)
+	if retention <= 0 {
+		return
+	}
+	cleanupRecordings(dir, retention)
+
+	go func() {
+		ticker := time.NewTicker(recordingCleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				cleanupRecordings(dir, retention)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
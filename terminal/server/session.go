@@ -1,10 +1,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"maps"
 	"os"
 	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // グローバルなセッションマネージャーインスタンス
@@ -18,18 +26,43 @@ func NewSessionManager() *SessionManager {
 	}
 }
 
+// SetStore はセッションの状態の保存先を設定する
+// 以降に作成するセッションは、保存された状態があれば引き継ぐ
+func (sm *SessionManager) SetStore(store SessionStore) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.store = store
+}
+
+// SetOverlayStore はセッションの書き込みの保存先を設定する
+// 以降に作成するセッションは、保存された書き込みがあれば引き継ぐ
+func (sm *SessionManager) SetOverlayStore(store OverlayStore) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.overlays = store
+}
+
 // GetSession は指定されたIDのセッションを取得
 // セッションが存在しない場合は新規作成
+// 他のプロセスで更新された状態は、セッションのロックを取得した後にrefreshSessionで反映する
 // 読み取りロックを使用して並行アクセスを最適化
-func (sm *SessionManager) GetSession(sessionID string) (*Session, error) {
+func (sm *SessionManager) GetSession(ctx context.Context, sessionID string) (*Session, error) {
+	ctx, span := tracer.Start(ctx, "session.get")
+	defer span.End()
+
 	// 読み取りロックでセッションの存在確認
 	sm.mu.RLock()
 	session, exists := sm.sessions[sessionID]
 	sm.mu.RUnlock()
+	span.SetAttributes(attribute.Bool(traceAttr("session.exists"), exists))
 
 	if !exists {
 		// セッションが存在しない場合は新規作成
-		return sm.createSession(sessionID)
+		session, err := sm.createSession(ctx, sessionID)
+		if err != nil {
+			recordSpanError(span, err)
+		}
+		return session, err
 	}
 	return session, nil
 }
@@ -37,7 +70,10 @@ func (sm *SessionManager) GetSession(sessionID string) (*Session, error) {
 // createSession は新しいシェルセッションを作成
 // シェルプロセスの起動と入出力パイプの設定を行う
 // 二重チェックロックパターンを使用して並行性を制御
-func (sm *SessionManager) createSession(sessionID string) (*Session, error) {
+func (sm *SessionManager) createSession(ctx context.Context, sessionID string) (*Session, error) {
+	_, span := tracer.Start(ctx, "session.create")
+	defer span.End()
+
 	// 書き込みロックを取得
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
@@ -48,6 +84,11 @@ func (sm *SessionManager) createSession(sessionID string) (*Session, error) {
 		return session, nil
 	}
 
+	// セッション数の上限を確認
+	if cfg.MaxSessions > 0 && len(sm.sessions) >= cfg.MaxSessions {
+		return nil, newMessageError("error.session_limit", param("limit", cfg.MaxSessions))
+	}
+
 	// 現在のユーザー名を取得
 	whoamiCmd := exec.Command("whoami")
 	username, err := whoamiCmd.Output()
@@ -58,7 +99,7 @@ func (sm *SessionManager) createSession(sessionID string) (*Session, error) {
 	// 新しいbashシェルプロセスを作成
 	shell := exec.Command("bash", "-l")
 	// ターミナルエミュレーションの設定
-	shell.Env = append(os.Environ(), "TERM=xterm-256color")
+	shell.Env = append(serverEnviron(), "TERM=xterm-256color")
 
 		// 入出力パイプの設定
 	// 各パイプはos.File型にキャストして使用
@@ -82,18 +123,585 @@ func (sm *SessionManager) createSession(sessionID string) (*Session, error) {
 		return nil, fmt.Errorf("shell start error: %v", err)
 	}
 
+	now := time.Now()
 	session := &Session{
 		ID:          sessionID,
-		CurrentDir:  "/home/nonroot", // デフォルトの作業ディレクトリ
-		PreviousDir: "/home/nonroot", // 初期値は現在のディレクトリと同じ
+		CurrentDir:  cfg.HomeDir, // デフォルトの作業ディレクトリ
+		PreviousDir: cfg.HomeDir, // 初期値は現在のディレクトリと同じ
 		Username:    strings.TrimSpace(string(username)), // ユーザー名を設定
 		Shell:       shell,
 		Stdin:       stdin.(*os.File),
 		Stdout:      stdout.(*os.File),
 		Stderr:      stderr.(*os.File),
+		CreatedAt:   now,
+		cwd:         cfg.HomeDir,
+		lastActive:  now,
+	}
+
+	// 仮想ファイルシステムでは、セッションごとの書き込みを重ねる
+	// 保存された作業ディレクトリが書き込みで作成したディレクトリの場合があるため、状態より先に読み込む
+	if virtualFS() && cfg.OverlayStore != "off" {
+		session.overlay = sm.loadOverlay(ctx, sessionID)
+	}
+
+	// 保存された状態があれば引き継ぐ（再起動前や他のプロセスで作成されたセッション）
+	if sm.store != nil {
+		sm.restoreSession(ctx, session)
 	}
 
 	// セッションをマップに登録
 	sm.sessions[sessionID] = session
+	sessionsCreated.Inc()
 	return session, nil
 }
+
+// セッションのシェルが終了するまで待機する最大時間
+const sessionCloseTimeout = 3 * time.Second
+
+// 端末の幅が分からない場合に使用する幅（桁数）
+const defaultColumns = 80
+
+// Count は現在のセッション数を返す
+func (sm *SessionManager) Count() int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return len(sm.sessions)
+}
+
+// SessionIDs は現在のセッションIDの一覧を返す
+func (sm *SessionManager) SessionIDs() []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	ids := make([]string, 0, len(sm.sessions))
+	for id := range sm.sessions {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Lookup は指定されたIDのセッションを取得する
+// GetSessionと異なり、セッションが存在しない場合も新規作成しない
+func (sm *SessionManager) Lookup(sessionID string) (*Session, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	session, exists := sm.sessions[sessionID]
+	return session, exists
+}
+
+// Sessions は現在のセッションを作成順に返す
+func (sm *SessionManager) Sessions() []*Session {
+	sm.mu.RLock()
+	sessions := make([]*Session, 0, len(sm.sessions))
+	for _, session := range sm.sessions {
+		sessions = append(sessions, session)
+	}
+	sm.mu.RUnlock()
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions
+}
+
+// errSessionKilled は、管理APIからセッションを終了した場合に実行中のコマンドに伝えるエラー
+var errSessionKilled = newMessageError("error.killed")
+
+// errInterrupted は、クライアントから中断（Ctrl-C）された場合に実行中のコマンドに伝えるエラー
+var errInterrupted = newMessageError("error.interrupted")
+
+// Kill は指定されたIDのセッションを強制的に終了する
+// 実行中のコマンドは中断し、シェルプロセスを回収する
+func (sm *SessionManager) Kill(sessionID string) error {
+	sm.mu.Lock()
+	session, exists := sm.sessions[sessionID]
+	delete(sm.sessions, sessionID)
+	sm.mu.Unlock()
+
+	if !exists {
+		return fmt.Errorf("セッションが存在しません: %s", sessionID)
+	}
+
+	// 実行中のコマンドを中断してからシェルを終了する
+	session.interrupt(errSessionKilled)
+	if err := session.Close(); err != nil {
+		return err
+	}
+
+	// 強制終了したセッションは引き継がない
+	if sm.store != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), sessionStoreTimeout)
+		defer cancel()
+		if err := sm.store.Delete(ctx, sessionID); err != nil {
+			slog.Warn("セッションの状態を削除できません", "error", err, "session_id", sessionID)
+		}
+	}
+	sm.deleteOverlay(sessionID)
+	return nil
+}
+
+// End はexitで終了したセッションを破棄する
+// 保存された状態も削除し、次のコマンドでは新しいセッションを作成する
+// セッションのロックを保持した状態で呼び出すため、シェルの終了はロックの解放後に行う
+func (sm *SessionManager) End(session *Session) {
+	sm.mu.Lock()
+	if sm.sessions[session.ID] == session {
+		delete(sm.sessions, session.ID)
+	}
+	store := sm.store
+	sm.mu.Unlock()
+
+	if store != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), sessionStoreTimeout)
+		defer cancel()
+		if err := store.Delete(ctx, session.ID); err != nil {
+			slog.Warn("セッションの状態を削除できません", "error", err, "session_id", session.ID)
+		}
+	}
+	sm.deleteOverlay(session.ID)
+
+	go func() {
+		if err := session.Close(); err != nil {
+			slog.Warn("セッション終了エラー", "session_id", session.ID, "error", err)
+		}
+	}()
+	slog.Info("exitによりセッションを終了", "session_id", session.ID)
+}
+
+// restoreSession は保存されたセッションの状態を読み込み、セッションに反映する
+// 読み込みに失敗した場合は新しいセッションとして扱う
+func (sm *SessionManager) restoreSession(ctx context.Context, session *Session) {
+	ctx, cancel := context.WithTimeout(ctx, sessionStoreTimeout)
+	defer cancel()
+
+	state, err := sm.store.Load(ctx, session.ID)
+	if err != nil {
+		slog.Warn("セッションの状態を読み込めません", "error", err, "session_id", session.ID)
+		return
+	}
+	if state == nil {
+		return
+	}
+	session.restore(state)
+	session.savedAt = state.SavedAt
+	slog.Info("セッションの状態を復元", "session_id", session.ID, "cwd", session.CurrentDir)
+}
+
+// refreshSession は、他のプロセスがセッションの状態を保存していればセッションに反映する
+// ワーカーの引き継ぎなどで他のプロセスが同じセッションのコマンドを実行した場合に、古い状態で実行しないようにする
+// 保存した状態が削除されている場合（他のプロセスでexitした・有効期限が切れた）は、新しいセッションの状態に戻す
+// セッションのロックを保持した状態で呼び出す
+func (sm *SessionManager) refreshSession(ctx context.Context, session *Session) {
+	sm.mu.RLock()
+	store := sm.store
+	sm.mu.RUnlock()
+	if store == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sessionStoreTimeout)
+	defer cancel()
+	state, err := store.Load(ctx, session.ID)
+	if err != nil {
+		loggerFrom(ctx).Warn("セッションの状態を読み込めません", "error", err)
+		return
+	}
+
+	switch {
+	case state == nil && !session.savedAt.IsZero():
+		if session.overlay != nil {
+			session.overlay = newOverlay()
+		}
+		session.restore(&SessionState{ID: session.ID, CreatedAt: time.Now()})
+		session.savedAt = time.Time{}
+		loggerFrom(ctx).Info("保存されたセッションの状態が削除されたため、セッションを初期化")
+	case state != nil && !state.SavedAt.Equal(session.savedAt):
+		// 作業ディレクトリが書き込みで作成したディレクトリの場合があるため、書き込みを先に読み込む
+		if session.overlay != nil {
+			session.overlay = sm.loadOverlay(ctx, session.ID)
+		}
+		session.restore(state)
+		session.savedAt = state.SavedAt
+		loggerFrom(ctx).Info("他のプロセスで更新されたセッションの状態を反映", "cwd", session.CurrentDir)
+	}
+}
+
+// saveSession はセッションの状態を保存する
+// セッションのロックを保持した状態で呼び出す
+func (sm *SessionManager) saveSession(ctx context.Context, session *Session) {
+	sm.mu.RLock()
+	store := sm.store
+	sm.mu.RUnlock()
+	if store == nil {
+		return
+	}
+
+	// コマンドがタイムアウトした場合も保存できるよう、キャンセルを引き継がない
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sessionStoreTimeout)
+	defer cancel()
+	state := session.State()
+	state.SavedAt = time.Now()
+	if err := store.Save(ctx, state); err != nil {
+		loggerFrom(ctx).Warn("セッションの状態を保存できません", "error", err)
+		return
+	}
+	session.savedAt = state.SavedAt
+}
+
+// loadOverlay は保存されたセッションの書き込みを読み込む
+// 保存されていない場合や読み込みに失敗した場合は、空の書き込みを返す
+func (sm *SessionManager) loadOverlay(ctx context.Context, sessionID string) *Overlay {
+	if sm.overlays == nil {
+		return newOverlay()
+	}
+	ctx, cancel := context.WithTimeout(ctx, sessionStoreTimeout)
+	defer cancel()
+
+	overlay, err := sm.overlays.Load(ctx, sessionID)
+	if err != nil {
+		slog.Warn("セッションの書き込みを読み込めません", "error", err, "session_id", sessionID)
+		return newOverlay()
+	}
+	if overlay == nil {
+		return newOverlay()
+	}
+	return overlay
+}
+
+// saveOverlay はセッションの書き込みに変更があれば保存する
+// セッションのロックを保持した状態で呼び出す
+func (sm *SessionManager) saveOverlay(ctx context.Context, session *Session) {
+	sm.mu.RLock()
+	store := sm.overlays
+	sm.mu.RUnlock()
+	if store == nil || session.overlay == nil || !session.overlay.dirty {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sessionStoreTimeout)
+	defer cancel()
+	if err := store.Save(ctx, session.ID, session.overlay); err != nil {
+		loggerFrom(ctx).Warn("セッションの書き込みを保存できません", "error", err)
+		return
+	}
+	session.overlay.dirty = false
+}
+
+// deleteOverlay は保存されたセッションの書き込みを削除する
+func (sm *SessionManager) deleteOverlay(sessionID string) {
+	sm.mu.RLock()
+	store := sm.overlays
+	sm.mu.RUnlock()
+	if store == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sessionStoreTimeout)
+	defer cancel()
+	if err := store.Delete(ctx, sessionID); err != nil {
+		slog.Warn("セッションの書き込みを削除できません", "error", err, "session_id", sessionID)
+	}
+}
+
+// CloseAll はすべてのセッションを終了し、シェルプロセスを回収する
+// 以降のGetSessionでは新しいセッションが作成される
+func (sm *SessionManager) CloseAll() {
+	sm.mu.Lock()
+	sessions := sm.sessions
+	sm.sessions = make(map[string]*Session)
+	sm.mu.Unlock()
+
+	for _, session := range sessions {
+		if err := session.Close(); err != nil {
+			slog.Warn("セッション終了エラー", "session_id", session.ID, "error", err)
+		}
+	}
+	slog.Info("全セッションを終了しました", "count", len(sessions))
+}
+
+// Close はセッションのシェルプロセスを終了し、回収する
+// 標準入力を閉じてシェルの終了を待ち、時間内に終了しない場合は強制終了する
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 標準入力を閉じるとbashはEOFを受け取って終了する
+	s.Stdin.Close()
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- s.Shell.Wait()
+	}()
+
+	select {
+	case <-exited:
+	case <-time.After(sessionCloseTimeout):
+		// 時間内に終了しない場合は強制終了して回収する
+		if err := s.Shell.Process.Kill(); err != nil {
+			return fmt.Errorf("shell kill error: %v", err)
+		}
+		<-exited
+	}
+
+	s.Stdout.Close()
+	s.Stderr.Close()
+	s.stopRecording()
+	return nil
+}
+
+// updateRecording は設定とクライアントの指定に従って録画を開始・停止する
+// セッションのロックを保持した状態で呼び出す
+func (s *Session) updateRecording(requested *bool) {
+	record := shouldRecord(s.recorder != nil, requested)
+	switch {
+	case record && s.recorder == nil:
+		recorder, err := newRecorder(cfg.RecordDir, s.ID, int64(cfg.RecordMaxSize))
+		if err != nil {
+			slog.Warn("録画を開始できません", "error", err, "session_id", s.ID)
+			return
+		}
+		s.recorder = recorder
+		slog.Info("録画を開始", "session_id", s.ID)
+	case !record && s.recorder != nil:
+		s.stopRecording()
+	default:
+		return
+	}
+
+	s.statsMu.Lock()
+	s.recording = s.recorder != nil
+	s.statsMu.Unlock()
+}
+
+// stopRecording は録画を終了する
+// セッションのロックを保持した状態で呼び出す
+func (s *Session) stopRecording() {
+	if s.recorder == nil {
+		return
+	}
+	if err := s.recorder.Close(); err != nil {
+		slog.Warn("録画の終了エラー", "error", err, "session_id", s.ID)
+	} else {
+		slog.Info("録画を終了", "session_id", s.ID)
+	}
+	s.recorder = nil
+}
+
+// beginCommand はコマンドの実行開始を記録し、管理APIから中断できるコンテキストを返す
+// セッションのロックを保持した状態で呼び出す
+func (s *Session) beginCommand(ctx context.Context, client string) context.Context {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	s.cancel = cancel
+	if client != "" {
+		s.client = client
+	}
+	return ctx
+}
+
+// endCommand はコマンドの実行結果を記録する
+// セッションのロックを保持した状態で呼び出す
+func (s *Session) endCommand(cmd string, result CommandResult, start time.Time) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	if s.cancel != nil {
+		s.cancel(nil)
+		s.cancel = nil
+	}
+	s.cwd = s.CurrentDir
+	s.lastActive = time.Now()
+	s.commandCount++
+	s.history = trimHistory(append(s.history, HistoryEntry{
+		Number:     s.commandCount,
+		Command:    cmd,
+		Status:     result.Status,
+		ExitCode:   result.exitCode,
+		Time:       start,
+		DurationMs: time.Since(start).Milliseconds(),
+	}))
+}
+
+// History は直近のコマンド履歴を古い順に返す
+func (s *Session) History() []HistoryEntry {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	return append([]HistoryEntry(nil), s.history...)
+}
+
+// interrupt は実行中のコマンドを中断する
+// 実行中のコマンドがなかった場合はfalseを返す
+func (s *Session) interrupt(cause error) bool {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	if s.cancel == nil {
+		return false
+	}
+	s.cancel(cause)
+	return true
+}
+
+// Info はセッションの情報を返す
+// withHistoryがtrueの場合は直近のコマンド履歴を含める
+func (s *Session) Info(withHistory bool) SessionInfo {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	info := SessionInfo{
+		ID:           s.ID,
+		Username:     s.Username,
+		Cwd:          s.cwd,
+		Client:       s.client,
+		CreatedAt:    s.CreatedAt,
+		LastActive:   s.lastActive,
+		IdleSeconds:  time.Since(s.lastActive).Seconds(),
+		CommandCount: s.commandCount,
+		Running:      s.cancel != nil,
+		Recording:    s.recording,
+	}
+	if withHistory {
+		info.History = append([]HistoryEntry(nil), s.history...)
+	}
+	return info
+}
+
+// State はセッションの保存できる状態を返す
+// セッションのロックを保持した状態で呼び出す
+func (s *Session) State() *SessionState {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	return &SessionState{
+		ID:           s.ID,
+		CurrentDir:   s.CurrentDir,
+		PreviousDir:  s.PreviousDir,
+		Username:     s.Username,
+		CreatedAt:    s.CreatedAt,
+		LastActive:   s.lastActive,
+		CommandCount: s.commandCount,
+		History:      append([]HistoryEntry(nil), s.history...),
+		Env:          maps.Clone(s.env),
+		Aliases:      maps.Clone(s.aliases),
+		Locale:       s.locale,
+	}
+}
+
+// restore は保存された状態をセッションに反映する
+// ユーザー名は現在のプロセスのものを使用し、存在しなくなったディレクトリはデフォルトのディレクトリに置き換える
+func (s *Session) restore(state *SessionState) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	s.CurrentDir = s.existingDir(state.CurrentDir, cfg.HomeDir)
+	s.PreviousDir = s.existingDir(state.PreviousDir, cfg.HomeDir)
+	s.cwd = s.CurrentDir
+	if !state.CreatedAt.IsZero() {
+		s.CreatedAt = state.CreatedAt
+	}
+	if !state.LastActive.IsZero() {
+		s.lastActive = state.LastActive
+	}
+	s.commandCount = state.CommandCount
+	s.history = trimHistory(state.History)
+	s.env = state.Env
+	s.aliases = state.Aliases
+	s.locale = negotiateLocale(state.Locale)
+}
+
+// Locale はリクエストで指定されたメッセージの言語を返す（指定されていない場合は空）
+func (s *Session) Locale() string {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	return s.locale
+}
+
+// setLocale はメッセージの言語を記録し、以降のリクエストで指定されない場合に使用する
+func (s *Session) setLocale(locale string) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	s.locale = locale
+}
+
+// existingDir はディレクトリが存在する場合はそのまま、存在しない場合はfallbackを返す
+func (s *Session) existingDir(dir, fallback string) string {
+	if dir == "" {
+		return fallback
+	}
+	if err := s.fsys().Chdir(dir); err != nil {
+		return fallback
+	}
+	return dir
+}
+
+// fsys はセッションのビルトインコマンドが参照するファイルシステムを返す
+// 書き込みできる場合は、仮想ファイルシステムにセッションの書き込みを重ねたものを返す
+func (s *Session) fsys() FileSystem {
+	if s.overlay == nil {
+		return fileSystem
+	}
+	return &overlayFS{base: fileSystem, overlay: s.overlay, owner: s.Username}
+}
+
+// homeDir はセッションのホームディレクトリを返す
+// exportでHOMEが設定されている場合はその値を使用する
+// 仮想ファイルシステムモードでは、サーバーのHOMEの代わりにhome-dirを使用する
+func (s *Session) homeDir() string {
+	if home := s.env["HOME"]; home != "" {
+		return home
+	}
+	if virtualFS() {
+		return cfg.HomeDir
+	}
+	return os.Getenv("HOME")
+}
+
+// inheritedEnv は、コマンドに引き継ぐサーバーの環境変数
+// サーバーの設定（REDIS_PASSWORD・TERMINAL_ADMIN_TOKENなど）を訪問者のコマンドから読めないよう、許可したもの以外は渡さない
+var inheritedEnv = []string{"PATH", "HOME", "USER", "LANG", "TERM"}
+
+// serverEnviron は、コマンドに引き継ぐサーバーの環境変数を返す
+func serverEnviron() []string {
+	var env []string
+	for _, name := range inheritedEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// environ はコマンドの実行に使用する環境変数を返す
+// 許可したサーバーの環境変数に、exportで設定した環境変数と言語（TERMINAL_LOCALE）を追加する
+func (s *Session) environ(locale string) []string {
+	env := serverEnviron()
+	for _, name := range sortedKeys(s.env) {
+		env = append(env, name+"="+s.env[name])
+	}
+	return append(env, "TERMINAL_LOCALE="+locale)
+}
+
+// expandAlias はコマンドの先頭の単語がエイリアスの場合に展開する
+// 展開は1回のみ行い、エイリアスの循環による無限展開を防ぐ
+func (s *Session) expandAlias(cmd string) string {
+	trimmed := strings.TrimLeft(cmd, " \t")
+	name, rest, _ := strings.Cut(trimmed, " ")
+	value, ok := s.aliases[name]
+	if !ok {
+		return cmd
+	}
+	if rest == "" {
+		return value
+	}
+	return value + " " + rest
+}
+
+// columns はセッションの端末の幅（桁数）を返す
+// exportでCOLUMNSが設定されていない場合は80とする
+func (s *Session) columns() int {
+	if columns, err := strconv.Atoi(s.env["COLUMNS"]); err == nil && columns > 0 {
+		return columns
+	}
+	return defaultColumns
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// memorySessionStore は、状態をJSONとしてメモリに保存するテスト用のSessionStore
+type memorySessionStore struct {
+	states map[string][]byte
+}
+
+func (s *memorySessionStore) Load(ctx context.Context, sessionID string) (*SessionState, error) {
+	data, ok := s.states[sessionID]
+	if !ok {
+		return nil, nil
+	}
+	var state SessionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (s *memorySessionStore) Save(ctx context.Context, state *SessionState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	s.states[state.ID] = data
+	return nil
+}
+
+func (s *memorySessionStore) Delete(ctx context.Context, sessionID string) error {
+	delete(s.states, sessionID)
+	return nil
+}
+
+func (s *memorySessionStore) Close() error { return nil }
+
+// TestRefreshSession は、他のプロセスが保存した状態をコマンドの実行前に反映することを確認する
+func TestRefreshSession(t *testing.T) {
+	dir := t.TempDir()
+	store := &memorySessionStore{states: make(map[string][]byte)}
+	// 同じストアを共有する2つのプロセス
+	a, b := NewSessionManager(), NewSessionManager()
+	a.SetStore(store)
+	b.SetStore(store)
+	ctx := context.Background()
+
+	sa := &Session{ID: "s", CurrentDir: dir, PreviousDir: dir}
+	sb := &Session{ID: "s", CurrentDir: dir, PreviousDir: dir}
+	a.saveSession(ctx, sa)
+
+	// 保存した時刻が変わらない場合は反映しない
+	sa.env = map[string]string{"LOCAL": "1"}
+	a.refreshSession(ctx, sa)
+	if sa.env["LOCAL"] != "1" {
+		t.Fatalf("refreshSession() replaced the state saved by the same process: env = %v", sa.env)
+	}
+
+	// 他のプロセスで実行したコマンドの状態を反映する
+	b.refreshSession(ctx, sb)
+	sb.CurrentDir = "/"
+	sb.env = map[string]string{"FOO": "bar"}
+	time.Sleep(time.Millisecond)
+	b.saveSession(ctx, sb)
+	a.refreshSession(ctx, sa)
+	if sa.CurrentDir != "/" || sa.env["FOO"] != "bar" {
+		t.Errorf("after handoff: cwd = %q, env = %v, want / and FOO=bar", sa.CurrentDir, sa.env)
+	}
+
+	// 他のプロセスでexitした場合は初期化する
+	store.Delete(ctx, "s")
+	a.refreshSession(ctx, sa)
+	if sa.env != nil || !sa.savedAt.IsZero() {
+		t.Errorf("after delete: env = %v, savedAt = %v, want a fresh session", sa.env, sa.savedAt)
+	}
+}
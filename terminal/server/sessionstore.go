@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// セッションの状態の保存に関する定数
+const (
+	sessionKeyPrefix    = "terminal:session:" // セッションの状態を保存するキーの接頭辞
+	sessionStoreTimeout = 2 * time.Second     // 保存・読み込み1回あたりの最大時間
+)
+
+// SessionState は、プロセスの再起動後も引き継ぐセッションの状態
+// シェルプロセスなど保存できないものは含めない
+type SessionState struct {
+	ID           string            `json:"id"`                // セッションID
+	CurrentDir   string            `json:"current_dir"`       // 現在の作業ディレクトリ
+	PreviousDir  string            `json:"previous_dir"`      // 直前の作業ディレクトリ
+	Username     string            `json:"username"`          // ユーザー名
+	CreatedAt    time.Time         `json:"created_at"`        // セッションの作成時刻
+	LastActive   time.Time         `json:"last_active"`       // 最後にコマンドを実行した時刻
+	CommandCount int               `json:"command_count"`     // 実行したコマンドの数
+	History      []HistoryEntry    `json:"history,omitempty"` // 直近のコマンド履歴
+	Env          map[string]string `json:"env,omitempty"`     // exportで設定した環境変数
+	Aliases      map[string]string `json:"aliases,omitempty"` // aliasで設定したエイリアス
+	Locale       string            `json:"locale,omitempty"`  // リクエストで指定されたメッセージの言語
+	SavedAt      time.Time         `json:"saved_at"`          // 状態を保存した時刻（他のプロセスによる更新の検出に使用）
+}
+
+// SessionStore は、セッションの状態を保存するインターフェース
+type SessionStore interface {
+	// Load は保存されたセッションの状態を読み込む
+	// 保存されていない場合はnilを返す
+	Load(ctx context.Context, sessionID string) (*SessionState, error)
+	// Save はセッションの状態を保存する
+	Save(ctx context.Context, state *SessionState) error
+	// Delete は保存されたセッションの状態を削除する
+	Delete(ctx context.Context, sessionID string) error
+	// Close はストアが保持する接続を閉じる
+	Close() error
+}
+
+// RedisSessionStore は、セッションの状態をRedisに保存するSessionStore
+// 保存するたびに有効期限を延長し、一定期間使われなかったセッションは自動的に削除される
+type RedisSessionStore struct {
+	rdb redis.UniversalClient
+	ttl time.Duration // 状態の有効期限（0の場合は無期限）
+}
+
+// NewRedisSessionStore は新しいRedisSessionStoreを作成
+func NewRedisSessionStore(rc RedisConfig, ttl time.Duration) (*RedisSessionStore, error) {
+	rdb, err := newRedisClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisSessionStore{rdb: rdb, ttl: ttl}, nil
+}
+
+// Load は保存されたセッションの状態を読み込み、有効期限を延長する
+func (s *RedisSessionStore) Load(ctx context.Context, sessionID string) (*SessionState, error) {
+	ctx, span := tracer.Start(ctx, "session.load")
+	defer span.End()
+
+	data, err := s.rdb.Get(ctx, sessionKeyPrefix+sessionID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		recordSpanError(span, err)
+		return nil, fmt.Errorf("セッションの読み込みエラー: %w", err)
+	}
+
+	var state SessionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		recordSpanError(span, err)
+		return nil, fmt.Errorf("セッションのパースエラー: %w", err)
+	}
+	if s.ttl > 0 {
+		s.rdb.Expire(ctx, sessionKeyPrefix+sessionID, s.ttl)
+	}
+	return &state, nil
+}
+
+// Save はセッションの状態を保存する
+func (s *RedisSessionStore) Save(ctx context.Context, state *SessionState) error {
+	ctx, span := tracer.Start(ctx, "session.save")
+	defer span.End()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := s.rdb.Set(ctx, sessionKeyPrefix+state.ID, data, s.ttl).Err(); err != nil {
+		recordSpanError(span, err)
+		return fmt.Errorf("セッションの保存エラー: %w", err)
+	}
+	return nil
+}
+
+// Delete は保存されたセッションの状態を削除する
+func (s *RedisSessionStore) Delete(ctx context.Context, sessionID string) error {
+	if err := s.rdb.Del(ctx, sessionKeyPrefix+sessionID).Err(); err != nil {
+		return fmt.Errorf("セッションの削除エラー: %w", err)
+	}
+	return nil
+}
+
+// Close はRedisとの接続を閉じる
+func (s *RedisSessionStore) Close() error {
+	return s.rdb.Close()
+}
+
+// newSessionStore は名前に対応するSessionStoreを作成
+// memoryの場合は保存しない（nilを返す）
+func newSessionStore(name string) (SessionStore, error) {
+	switch name {
+	case "memory":
+		return nil, nil
+	case "redis":
+		return NewRedisSessionStore(cfg.Redis, cfg.SessionTTL)
+	default:
+		return nil, fmt.Errorf("不明なセッションの保存先です: %s", name)
+	}
+}
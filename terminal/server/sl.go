@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+func init() {
+	builtins.Register(slBuiltin{})
+}
+
+// slのアニメーションの1フレームを表示する間隔
+const slFrameInterval = 50 * time.Millisecond
+
+// slで表示する汽車（煙と車輪は2パターンを交互に表示する）
+var (
+	slSmoke = [2]string{
+		"   (@@)  (  )   (@)   ( )  ",
+		"  (  )  (@@)  ( )   (@)    ",
+	}
+	slBody = []string{
+		"    ||     _______________ ",
+		"   _||____|  ____   ____  |",
+		"  |  []   | |____| |____| |",
+		"  |_______|_______________|",
+	}
+	slWheels = [2]string{
+		"   (O)(O)   (O)      (O)   ",
+		"   (o)(o)   (o)      (o)   ",
+	}
+)
+
+// 汽車の幅（桁数）
+var slWidth = len(slBody[0])
+
+// slBuiltin は汽車（SL）を走らせるコマンド
+// 出力を逐次送信できる場合はアニメーションを表示し、できない場合は停車した汽車を1枚だけ表示する
+type slBuiltin struct{}
+
+func (slBuiltin) Name() string               { return "sl" }
+func (slBuiltin) Usage() string              { return "sl" }
+func (slBuiltin) Help() string               { return "SLが走ります（Ctrl-Cで停止）" }
+func (slBuiltin) Completion() completionKind { return completeNone }
+
+func (slBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	width := session.columns()
+	stream, ok := outputStreamFrom(ctx)
+	if !ok {
+		return strings.Join(slFrame(width, (width-slWidth)/2, 0), "\n"), nil
+	}
+
+	// 画面の右端から左端まで、設定した時間をかけて走らせる
+	frames := max(int(cfg.SLDuration/slFrameInterval), 2)
+	ticker := time.NewTicker(slFrameInterval)
+	defer ticker.Stop()
+	for i := 0; i < frames; i++ {
+		x := width - (width+slWidth)*i/(frames-1)
+		frame := "\x1b[H\x1b[2J" + strings.Join(slFrame(width, x, i), "\r\n")
+		if err := stream(frame); err != nil {
+			return "", newMessageError("sl.send_failed", err)
+		}
+		if session.recorder != nil {
+			session.recorder.Write([]byte(frame))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			// 中断（Ctrl-C）・タイムアウトの場合は画面を消去して終了する
+			return clearScreen, slStopError(ctx)
+		}
+	}
+	return clearScreen, nil
+}
+
+// slStopError は、アニメーションを途中で終了した理由を、セッションの言語に変換できるエラーとして返す
+// 理由は外部コマンドの強制終了（executeNormalCommand）と同じく区別する
+func slStopError(ctx context.Context) error {
+	cause := context.Cause(ctx)
+	switch {
+	case errors.Is(cause, errInterrupted):
+		return errInterrupted
+	case errors.Is(cause, errSessionKilled):
+		return errSessionKilled
+	case errors.Is(cause, context.DeadlineExceeded):
+		return newMessageError("error.timeout", param("timeout", cfg.CommandTimeout.String()))
+	default:
+		return newMessageError("error.canceled")
+	}
+}
+
+// slFrame は汽車の左端を列xに置いたフレームを、画面の幅で切り取って返す
+// xが負の場合や画面の幅を超える場合は、画面に収まる部分のみを返す
+func slFrame(width, x, n int) []string {
+	art := make([]string, 0, len(slBody)+2)
+	art = append(art, slSmoke[n%2])
+	art = append(art, slBody...)
+	art = append(art, slWheels[n%2])
+
+	lines := make([]string, len(art))
+	for i, line := range art {
+		start, end := max(-x, 0), min(len(line), width-x)
+		if start >= end {
+			continue
+		}
+		lines[i] = strings.Repeat(" ", max(x, 0)) + line[start:end]
+	}
+	return lines
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// 1行あたりの最大サイズ（バイト）
+const maxStdioLineSize = 1024 * 1024
+
+// StdioTransport は、標準入出力を使用するJSON Linesトランスポート
+// 1行に1つのPayloadを読み込み、結果を1行に1つのCommandResultとして書き出す
+// RedisやAPIサーバーを用意せずにローカルでのデバッグやテストを行うために使用する
+type StdioTransport struct {
+	in  io.Reader  // メッセージの読み込み元
+	out io.Writer  // 結果の書き込み先
+	mu  sync.Mutex // 書き込みの排他制御用ミューテックス
+}
+
+// NewStdioTransport は標準入出力を使用するStdioTransportを作成
+func NewStdioTransport() *StdioTransport {
+	return &StdioTransport{
+		in:  os.Stdin,
+		out: os.Stdout,
+	}
+}
+
+// Listen は入力を1行ずつ読み込み、メッセージとして流す
+// 入力が終端に達するとチャンネルをクローズする
+func (t *StdioTransport) Listen(ctx context.Context) (<-chan *Message, error) {
+	out := make(chan *Message)
+	go func() {
+		defer close(out)
+
+		scanner := bufio.NewScanner(t.in)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxStdioLineSize)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			// 空行は読み飛ばす
+			if line == "" {
+				continue
+			}
+			m := &Message{
+				Payload:   line,
+				Client:    "stdio",
+				Streaming: true,
+				reply:     t.Publish,
+			}
+			select {
+			case out <- m:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			slog.Error("標準入力の読み込みエラー", "error", err)
+		}
+	}()
+	return out, nil
+}
+
+// Publish は結果を1行のJSONとして書き出す
+func (t *StdioTransport) Publish(ctx context.Context, result *CommandResult) error {
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("JSON変換エラー: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err := fmt.Fprintf(t.out, "%s\n", resultJSON); err != nil {
+		return fmt.Errorf("標準出力への書き込みエラー: %w", err)
+	}
+	return nil
+}
+
+// Close は何もしない（標準入出力はプロセス終了時に閉じられる）
+func (t *StdioTransport) Close() error {
+	return nil
+}
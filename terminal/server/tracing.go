@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// トレースのサービス名・計装名
+const tracerName = "terminal"
+
+// tracer はサーバー内のスパンを作成するトレーサー
+// setupTracingを呼ぶまではスパンを記録しない
+var tracer = otel.Tracer(tracerName)
+
+// traceAttr はスパンの属性名に共通の接頭辞を付ける
+func traceAttr(name string) string {
+	return "terminal." + name
+}
+
+// setupTracing はトレースの出力先を設定し、終了時に呼ぶ関数を返す
+// 終了関数は未送信のスパンを出力してからエクスポーターを閉じる
+func setupTracing(ctx context.Context, c *Config) (func(context.Context) error, error) {
+	// W3C Trace Context（traceparent / tracestate）で親スパンを受け取る
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var exporter sdktrace.SpanExporter
+	var closeFile func() error
+	switch c.TraceExporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if c.TraceEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(c.TraceEndpoint))
+		}
+		exp, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("OTLPエクスポーターの作成に失敗しました: %w", err)
+		}
+		exporter = exp
+	case "file":
+		// 1行に1スパンのJSONを追記する
+		f, err := os.OpenFile(c.TraceFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("トレースファイルを開けません: %w", err)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("ファイルエクスポーターの作成に失敗しました: %w", err)
+		}
+		exporter = exp
+		closeFile = f.Close
+	default:
+		return nil, fmt.Errorf("不明なトレースの出力先です: %s", c.TraceExporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(tracerName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("リソースの作成に失敗しました: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeFile != nil {
+			if cerr := closeFile(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
+
+// startRequestSpan はコマンド1件の処理全体を表すスパンを開始する
+// ペイロードにtraceparentが含まれる場合は、そのスパンを親とする
+// receivedにはメッセージを受信した時刻を指定する
+func startRequestSpan(payload *Payload, received time.Time) (context.Context, trace.Span) {
+	carrier := propagation.MapCarrier{}
+	if payload.TraceParent != "" {
+		carrier["traceparent"] = payload.TraceParent
+	}
+	if payload.TraceState != "" {
+		carrier["tracestate"] = payload.TraceState
+	}
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+
+	return tracer.Start(ctx, "terminal.command",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithTimestamp(received),
+		trace.WithAttributes(
+			attribute.String(traceAttr("session_id"), payload.SessionID),
+			attribute.String(traceAttr("request_id"), payload.RequestID),
+			attribute.String(traceAttr("command.name"), commandName(payload.Command)),
+			attribute.String(traceAttr("transport"), cfg.Transport),
+		),
+	)
+}
+
+// endRequestSpan はコマンドの結果をスパンに記録して終了する
+func endRequestSpan(span trace.Span, result *CommandResult) {
+	span.SetAttributes(attribute.String(traceAttr("status"), result.Status))
+	if result.Status == "error" {
+		span.SetStatus(codes.Error, result.Error)
+	}
+	span.End()
+}
+
+// recordSpanError はエラーをスパンに記録する
+func recordSpanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// commandName はコマンドの先頭の単語を返す
+// 引数には秘密情報が含まれる可能性があるため、スパンにはコマンド名のみを記録する
+func commandName(cmd string) string {
+	fields := strings.Fields(cmd)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
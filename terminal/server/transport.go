@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+)
+
+// Transport は、コマンドの受信と結果の送信を抽象化するインターフェース
+// Redis Pub/Sub や WebSocket など、クライアントとの通信経路ごとに実装する
+type Transport interface {
+	// Listen はコマンドの受信を開始し、受信したメッセージを流すチャンネルを返す
+	// トランスポートが閉じられるとチャンネルもクローズされる
+	Listen(ctx context.Context) (<-chan *Message, error)
+	// Publish はセッションIDを宛先として結果を送信する
+	// リクエストに紐づかない通知（ブロードキャストなど）に使用する
+	Publish(ctx context.Context, result *CommandResult) error
+	// Close はトランスポートが保持する接続をすべて閉じる
+	Close() error
+}
+
+// Message は、トランスポートから受信した1件のメッセージ
+// 受信したトランスポートへの返信手段を保持する
+type Message struct {
+	Payload        string                                                 // 受信した生のメッセージ（JSON）
+	Client         string                                                 // 送信元の情報（WebSocketのリモートアドレスなど）
+	Streaming      bool                                                   // 1件のリクエストに複数回返信できるかどうか（実行中の出力の逐次送信に使用）
+	AcceptLanguage string                                                 // 接続時のAccept-Languageヘッダー（WebSocketの場合のみ）
+	reply          func(ctx context.Context, result *CommandResult) error // 送信元への返信関数
+}
+
+// Reply はメッセージの送信元に結果を返す
+func (m *Message) Reply(ctx context.Context, result *CommandResult) error {
+	return m.reply(ctx, result)
+}
+
+// outputStreamKey は、コンテキストにOutputStreamを格納するためのキー
+type outputStreamKey struct{}
+
+// OutputStream は、コマンドの実行中に出力を逐次送信する関数
+// 送信した出力は status が output の結果として、最終的な結果より前にクライアントに届く
+type OutputStream func(output string) error
+
+// withOutputStream はOutputStreamを格納したコンテキストを返す
+func withOutputStream(ctx context.Context, stream OutputStream) context.Context {
+	return context.WithValue(ctx, outputStreamKey{}, stream)
+}
+
+// outputStreamFrom はコンテキストに格納されたOutputStreamを返す
+// トランスポートが逐次送信に対応していない場合はfalseを返す
+func outputStreamFrom(ctx context.Context) (OutputStream, bool) {
+	stream, ok := ctx.Value(outputStreamKey{}).(OutputStream)
+	return stream, ok
+}
@@ -1,15 +1,26 @@
 package main
 
 import (
+	"context"
 	"os"
 	"os/exec"
 	"sync"
+	"time"
 )
 
 // redisからのメッセージを受信するための
 type Payload struct {
-	Command     string `json:"command"`     // コマンド
-	SessionID   string `json:"session_id"`  // セッションID
+	Type           string `json:"type,omitempty"`            // メッセージの種類（command / complete、省略時はcommand）
+	Command        string `json:"command"`                   // コマンド（completeの場合は入力途中の行）
+	Cursor         *int   `json:"cursor,omitempty"`          // 補完するカーソル位置（completeの場合、文字単位。省略時は行末）
+	SessionID      string `json:"session_id"`                // セッションID
+	RequestID      string `json:"request_id,omitempty"`      // リクエストID（省略時はサーバーで生成）
+	TraceParent    string `json:"traceparent,omitempty"`     // 呼び出し元のスパン（W3C Trace Contextのtraceparent）
+	TraceState     string `json:"tracestate,omitempty"`      // ベンダー固有のトレース情報（W3C Trace Contextのtracestate）
+	Record         *bool  `json:"record,omitempty"`          // セッションの録画を開始・停止する（record-modeがopt-inの場合）
+	Locale         string `json:"locale,omitempty"`          // メッセージの言語（例: "en"、省略時はAccept-Language・セッションの言語）
+	AcceptLanguage string `json:"accept_language,omitempty"` // ブラウザのAccept-Language（APIが転送する）
+	Client         string `json:"-"`                         // 送信元の情報（トランスポートが設定）
 }
 
 // Session は、各クライアントのシェルセッションを管理する構造体
@@ -25,6 +36,50 @@ type Session struct {
 	Stdout        *os.File    // 標準出力パイプ（コマンド出力用）
 	Stderr        *os.File    // 標準エラー出力パイプ（エラー出力用）
 	mu            sync.Mutex  // セッション操作の排他制御用ミューテックス（同時実行制御）
+	CreatedAt     time.Time   // セッションの作成時刻
+	recorder      *Recorder   // セッションの録画（録画していない場合はnil、muで保護）
+	env           map[string]string // exportで設定した環境変数（muで保護）
+	aliases       map[string]string // aliasで設定したエイリアス（muで保護）
+	exited        bool        // exitで終了したかどうか（muで保護）
+	overlay       *Overlay    // 仮想ファイルシステムへの書き込み（書き込みできない場合はnil、muで保護）
+	savedAt       time.Time   // 最後に保存・復元した状態の保存時刻（他のプロセスによる更新の検出に使用、muで保護）
+
+	// 以下は管理APIで参照する情報
+	// コマンドの実行中（muを保持している間）も参照できるように、statsMuで保護する
+	statsMu       sync.Mutex              // 管理用の情報の排他制御用ミューテックス
+	client        string                  // 最後にコマンドを送信したクライアント
+	cwd           string                  // 最後のコマンド実行後の作業ディレクトリ
+	lastActive    time.Time               // 最後にコマンドを実行した時刻
+	commandCount  int                     // 実行したコマンドの数
+	history       []HistoryEntry          // 直近のコマンド履歴（古い順）
+	cancel        context.CancelCauseFunc // 実行中のコマンドを中断する関数（実行中でない場合はnil）
+	recording     bool                    // 録画中かどうか
+	locale        string                  // リクエストで指定されたメッセージの言語（指定されていない場合は空）
+}
+
+// HistoryEntry は、セッションで実行したコマンド1件の記録
+type HistoryEntry struct {
+	Number     int       `json:"number"`      // 履歴番号（!nで指定する番号）
+	Command    string    `json:"command"`     // 実行したコマンド
+	Status     string    `json:"status"`      // 実行結果のステータス
+	ExitCode   int       `json:"exit_code"`   // 終了コード
+	Time       time.Time `json:"time"`        // 実行を開始した時刻
+	DurationMs int64     `json:"duration_ms"` // 実行にかかった時間（ミリ秒）
+}
+
+// SessionInfo は、管理APIで返すセッションの情報
+type SessionInfo struct {
+	ID           string         `json:"id"`                // セッションID
+	Username     string         `json:"username"`          // ユーザー名
+	Cwd          string         `json:"cwd"`               // 作業ディレクトリ
+	Client       string         `json:"client,omitempty"`  // 最後にコマンドを送信したクライアント
+	CreatedAt    time.Time      `json:"created_at"`        // セッションの作成時刻
+	LastActive   time.Time      `json:"last_active"`       // 最後にコマンドを実行した時刻
+	IdleSeconds  float64        `json:"idle_seconds"`      // 最後のコマンドからの経過時間（秒）
+	CommandCount int            `json:"command_count"`     // 実行したコマンドの数
+	Running      bool           `json:"running"`           // コマンドを実行中かどうか
+	Recording    bool           `json:"recording"`         // 録画中かどうか
+	History      []HistoryEntry `json:"history,omitempty"` // 直近のコマンド履歴（個別に取得した場合のみ）
 }
 
 // SessionManager は、複数のセッションを管理する構造体
@@ -33,17 +88,25 @@ type Session struct {
 type SessionManager struct {
 	sessions map[string]*Session 	// セッションIDをキーとするセッションマップ
 	mu       sync.RWMutex       	// セッションマップの排他制御用ミューテックス
+	store    SessionStore       	// セッションの状態の保存先（nilの場合は保存しない）
+	overlays OverlayStore       	// セッションの書き込みの保存先（nilの場合は保存しない）
 }
 
 // CommandResult は、コマンド実行の結果を表す構造体
 // Redisを通じてクライアントに返される形式
 // 各フィールドはJSONとしてシリアライズされる
 type CommandResult struct {
-	Status    string `json:"status"`    			// 実行結果のステータス（success/error）
+	Status    string `json:"status"`    			// 実行結果のステータス（success/error/notice/output）
 	Command   string `json:"command"`   			// 実行されたコマンド
 	Result    string `json:"result,omitempty"`    	// コマンドの出力結果（エラー時は空）
 	Error     string `json:"error,omitempty"`     	// エラーメッセージ（エラー時のみ）
 	Pwd       string `json:"pwd,omitempty"`       	// 現在の作業ディレクトリ
 	Username  string `json:"username,omitempty"`  	// 現在のユーザー名
 	SessionID string `json:"session_id,omitempty"` 	// セッション識別子（クライアント識別用）
+	RequestID string `json:"request_id,omitempty"` 	// リクエスト識別子（ログとの突き合わせ用）
+	Completion *Completion `json:"completion,omitempty"` // 補完の結果（completeの場合のみ）
+	ErrorCode   ErrorCode      `json:"error_code,omitempty"`   // エラーの種類（エラー時のみ、例: POLICY_DENIED）
+	ErrorParams map[string]any `json:"error_params,omitempty"` // エラーメッセージのパラメータ（例: {"command": "rm"}）
+	Actions     []Action       `json:"actions,omitempty"`      // フロントエンドに実行させる操作（例: 画面の消去・URLを開く）
+	exitCode  int                                   	// 終了コード（履歴の記録用、JSONには含めない）
 }
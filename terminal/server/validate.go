@@ -1,33 +1,27 @@
 package main
 
 import (
-	"fmt"
 	"strings"
 	"unicode/utf8"
 )
 
 
 func valivateCommand(cmd string) error {
-	// ブラックリストに含まれるコマンドを定義
-	var BlacklistMap = map[string]struct{}{
-		"rm":       {},
-		"shutdown": {},
-	}
-
 	// 空白で分割（例: "rm -rf /tmp" → ["rm", "-rf", "/tmp"]）
 	parts := strings.Fields(cmd)
 
-	// コマンドが空の場合はエラー
-	if cmd == "" {
-		return fmt.Errorf("コマンドが空です")
+	// コマンドが空（空白のみを含む）の場合はエラー
+	// エイリアスを展開した結果が空白のみになる場合もある
+	if len(parts) == 0 {
+		return newMessageError("validate.empty_command")
 	}
 
 	// 最初の要素だけを見る（実行されるコマンド名）
 	baseCmd := parts[0]
 
-	// ブラックリストに含まれるコマンドをチェック
-	if _, exists := BlacklistMap[baseCmd]; exists {
-		return fmt.Errorf("このコマンドは実行できません: %s", baseCmd)
+	// ポリシーで許可されていないコマンドをチェック
+	if !policy.Allows(baseCmd) {
+		return newMessageError("validate.denied", param("command", baseCmd))
 	}
 
 	return nil
@@ -36,16 +30,22 @@ func valivateCommand(cmd string) error {
 func validateCommandResult(result *CommandResult) error {
 	// セッションIDが空の場合はエラー
 	if result.SessionID == "" {
-		return fmt.Errorf("セッションIDが空です")
+		return newMessageError("validate.empty_session")
 	}
 
 	// 実行結果が異様に長い場合はエラー
-	if len(result.Result) > 10000 {
-		return fmt.Errorf("コマンドの実行結果が異常に長いです")
+	if len(result.Result) > cfg.MaxOutputSize {
+		return newMessageError("validate.output_too_large")
 	}
 	// 実行結果に不正な文字列が含まれている場合はエラー
 	if !utf8.ValidString(result.Result) {
-		return fmt.Errorf("コマンドの実行結果に不正な文字列が含まれています")
+		return newMessageError("validate.invalid_output")
+	}
+	// フロントエンドに実行させる操作を許可リストで検証
+	for _, action := range result.Actions {
+		if err := validateAction(action); err != nil {
+			return err
+		}
 	}
 
 	return nil
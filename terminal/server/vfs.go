@@ -0,0 +1,362 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ポートフォリオのコンテンツ（contentディレクトリが仮想ファイルシステムの / になる）
+//
+//go:embed all:content
+var embeddedContent embed.FS
+
+// 仮想ファイルシステムのパーミッションの定義
+//
+//go:embed vfs.json
+var embeddedManifest []byte
+
+// ファイルシステムの操作で返すエラー
+var (
+	errIsDir  = errors.New("ディレクトリです")
+	errNotDir = errors.New("ディレクトリではありません")
+)
+
+// FileSystem は、ビルトインコマンドと補完が参照するファイルシステムのインターフェース
+// パスはすべて絶対パスで指定する
+type FileSystem interface {
+	// Stat はファイルの情報を返す
+	Stat(name string) (fs.FileInfo, error)
+	// ReadDir はディレクトリの内容を名前順に返す
+	ReadDir(name string) ([]fs.DirEntry, error)
+	// ReadFile はファイルの内容を返す
+	ReadFile(name string) ([]byte, error)
+	// Chdir は作業ディレクトリにできるかどうかを確認する
+	Chdir(name string) error
+}
+
+// グローバルなファイルシステム
+// fs-modeがvirtualの場合は、mainで仮想ファイルシステムに置き換える
+var fileSystem FileSystem = hostFS{}
+
+// setupFileSystem はfs-modeに応じてファイルシステムを設定する
+func setupFileSystem(c *Config) error {
+	if c.FSMode != "virtual" {
+		return nil
+	}
+	current, err := user.Current()
+	if err != nil {
+		return fmt.Errorf("ユーザー名の取得エラー: %w", err)
+	}
+	content, err := fs.Sub(embeddedContent, "content")
+	if err != nil {
+		return err
+	}
+	vfs, err := NewVirtualFS(content, embeddedManifest, current.Username)
+	if err != nil {
+		return err
+	}
+	// セッションの初期ディレクトリは仮想ファイルシステム上に存在する必要がある
+	if err := vfs.Chdir(c.HomeDir); err != nil {
+		return fmt.Errorf("home-dir を作業ディレクトリにできません: %w", err)
+	}
+	fileSystem = vfs
+	return nil
+}
+
+// virtualFS は、fs-modeがvirtualかどうかを返す
+func virtualFS() bool {
+	return cfg.FSMode == "virtual"
+}
+
+// fsErrorMessage はファイルシステムのエラーを、言語に応じた表示用のメッセージに変換する
+func fsErrorMessage(locale string, err error) string {
+	var quota *quotaError
+	switch {
+	case errors.As(err, &quota):
+		return translate(locale, "fs.quota."+quota.kind, quota.limit)
+	case errors.Is(err, fs.ErrNotExist):
+		return translate(locale, "fs.not_found")
+	case errors.Is(err, fs.ErrPermission):
+		return translate(locale, "fs.permission_denied")
+	case errors.Is(err, errIsDir):
+		return translate(locale, "fs.is_dir")
+	case errors.Is(err, errNotDir):
+		return translate(locale, "fs.not_dir")
+	case errors.Is(err, errReadOnly):
+		return translate(locale, "fs.read_only")
+	case errors.Is(err, errExist):
+		return translate(locale, "fs.exist")
+	default:
+		return err.Error()
+	}
+}
+
+// hostFS は、サーバーのファイルシステムをそのまま使用するFileSystem
+type hostFS struct{}
+
+func (hostFS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (hostFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (hostFS) ReadFile(name string) ([]byte, error)       { return os.ReadFile(name) }
+
+func (hostFS) Chdir(name string) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &fs.PathError{Op: "chdir", Path: name, Err: errNotDir}
+	}
+	return nil
+}
+
+// vfsManifest は、仮想ファイルシステムのパーミッションの定義（vfs.json）
+// entriesにないファイル・ディレクトリは、所有者がdefault_owner、モードが0644（ディレクトリは0755）になる
+type vfsManifest struct {
+	DefaultOwner string                      `json:"default_owner"` // デフォルトの所有者
+	Entries      map[string]vfsManifestEntry `json:"entries"`       // 絶対パスをキーとするパーミッション
+}
+
+// vfsManifestEntry は、vfs.jsonのファイル・ディレクトリ1件の定義
+type vfsManifestEntry struct {
+	Owner  string `json:"owner"`  // 所有者（省略時はdefault_owner）
+	Mode   string `json:"mode"`   // 8進数のパーミッション（例: "0600"）
+	Hidden bool   `json:"hidden"` // ls・treeに表示しない（パスを指定すれば参照できる）
+}
+
+// vfsMeta は、仮想ファイルシステムのファイル・ディレクトリの属性
+type vfsMeta struct {
+	owner   string
+	perm    fs.FileMode
+	hasPerm bool // falseの場合はデフォルトのパーミッションを使用する
+	hidden  bool
+}
+
+// VirtualFS は、バイナリに組み込んだコンテンツを読み取り専用で公開するFileSystem
+// サーバーのファイルシステムには一切アクセスしない
+type VirtualFS struct {
+	content      fs.FS              // コンテンツ（ルートが / に対応する）
+	user         string             // パーミッションの確認に使用するユーザー名
+	defaultOwner string             // entriesにないファイルの所有者
+	entries      map[string]vfsMeta // パスをキーとする属性
+	modTime      time.Time          // すべてのファイルの更新日時（作成した時刻）
+}
+
+// NewVirtualFS は新しいVirtualFSを作成
+// manifestはvfs.jsonの内容、userは閲覧者のユーザー名
+func NewVirtualFS(content fs.FS, manifest []byte, user string) (*VirtualFS, error) {
+	var m vfsManifest
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return nil, fmt.Errorf("仮想ファイルシステムの定義のパースエラー: %w", err)
+	}
+	v := &VirtualFS{
+		content:      content,
+		user:         user,
+		defaultOwner: m.DefaultOwner,
+		entries:      make(map[string]vfsMeta, len(m.Entries)),
+		modTime:      time.Now(),
+	}
+	for name, e := range m.Entries {
+		if !path.IsAbs(name) {
+			return nil, fmt.Errorf("仮想ファイルシステムの定義のパスは絶対パスを指定してください: %s", name)
+		}
+		meta := vfsMeta{owner: e.Owner, hidden: e.Hidden}
+		if meta.owner == "" {
+			meta.owner = m.DefaultOwner
+		}
+		if e.Mode != "" {
+			perm, err := strconv.ParseUint(e.Mode, 8, 32)
+			if err != nil || perm > 0o777 {
+				return nil, fmt.Errorf("仮想ファイルシステムの定義のモードが不正です: %s: %s", name, e.Mode)
+			}
+			meta.perm, meta.hasPerm = fs.FileMode(perm), true
+		}
+		v.entries[path.Clean(name)] = meta
+	}
+	return v, nil
+}
+
+// meta はファイル・ディレクトリの属性を返す
+func (v *VirtualFS) meta(name string, isDir bool) vfsMeta {
+	m, ok := v.entries[name]
+	if !ok {
+		m = vfsMeta{owner: v.defaultOwner}
+	}
+	if !m.hasPerm {
+		m.perm = 0o644
+		if isDir {
+			m.perm = 0o755
+		}
+	}
+	return m
+}
+
+// can は閲覧者がパーミッション（4: 読み込み、1: 実行）を持っているかどうかを返す
+// 所有者の場合は所有者のビット、それ以外はその他のビットで判定する
+func (v *VirtualFS) can(m vfsMeta, want fs.FileMode) bool {
+	perm := m.perm
+	if m.owner == v.user {
+		perm >>= 6
+	}
+	return perm&want == want
+}
+
+// lookup はパスの情報と属性を返す
+// 途中のディレクトリに実行権限がない場合はfs.ErrPermissionを返す
+func (v *VirtualFS) lookup(op, name string) (*vfsFileInfo, vfsMeta, error) {
+	if !path.IsAbs(name) {
+		return nil, vfsMeta{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	name = path.Clean(name)
+
+	// ルートから順に、親ディレクトリを通過できるかどうかを確認する
+	var ancestors []string
+	for dir := path.Dir(name); name != "/"; dir = path.Dir(dir) {
+		ancestors = append(ancestors, dir)
+		if dir == "/" {
+			break
+		}
+	}
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		dir := ancestors[i]
+		info, err := fs.Stat(v.content, v.fsPath(dir))
+		if err != nil {
+			return nil, vfsMeta{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if !info.IsDir() {
+			return nil, vfsMeta{}, &fs.PathError{Op: op, Path: name, Err: errNotDir}
+		}
+		if !v.can(v.meta(dir, true), 1) {
+			return nil, vfsMeta{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+		}
+	}
+
+	info, err := fs.Stat(v.content, v.fsPath(name))
+	if err != nil {
+		return nil, vfsMeta{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	meta := v.meta(name, info.IsDir())
+	return v.fileInfo(info, meta), meta, nil
+}
+
+// fsPath は絶対パスをcontentのパスに変換する
+func (v *VirtualFS) fsPath(name string) string {
+	if name == "/" {
+		return "."
+	}
+	return strings.TrimPrefix(name, "/")
+}
+
+// fileInfo は組み込みのファイルの情報に、仮想的な属性を付加する
+func (v *VirtualFS) fileInfo(info fs.FileInfo, meta vfsMeta) *vfsFileInfo {
+	mode := meta.perm
+	if info.IsDir() {
+		mode |= fs.ModeDir
+	}
+	return &vfsFileInfo{FileInfo: info, mode: mode, owner: meta.owner, modTime: v.modTime}
+}
+
+// Stat はファイルの情報を返す
+func (v *VirtualFS) Stat(name string) (fs.FileInfo, error) {
+	info, _, err := v.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ReadDir はディレクトリの内容を名前順に返す
+// hiddenを指定したファイルは含めない
+func (v *VirtualFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	info, meta, err := v.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	if !v.can(meta, 4) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrPermission}
+	}
+
+	dir := path.Clean(name)
+	entries, err := fs.ReadDir(v.content, v.fsPath(dir))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		childInfo, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		childMeta := v.meta(path.Join(dir, entry.Name()), entry.IsDir())
+		if childMeta.hidden {
+			continue
+		}
+		result = append(result, fs.FileInfoToDirEntry(v.fileInfo(childInfo, childMeta)))
+	}
+	return result, nil
+}
+
+// ReadFile はファイルの内容を返す
+func (v *VirtualFS) ReadFile(name string) ([]byte, error) {
+	info, meta, err := v.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+	if !v.can(meta, 4) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return fs.ReadFile(v.content, v.fsPath(path.Clean(name)))
+}
+
+// Chdir は作業ディレクトリにできるかどうかを確認する
+func (v *VirtualFS) Chdir(name string) error {
+	info, meta, err := v.lookup("chdir", name)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &fs.PathError{Op: "chdir", Path: name, Err: errNotDir}
+	}
+	if !v.can(meta, 1) {
+		return &fs.PathError{Op: "chdir", Path: name, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+// vfsFileInfo は、仮想的なモード・所有者・更新日時を持つファイルの情報
+type vfsFileInfo struct {
+	fs.FileInfo
+	mode    fs.FileMode
+	owner   string
+	modTime time.Time
+}
+
+func (i *vfsFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i *vfsFileInfo) ModTime() time.Time { return i.modTime }
+
+// fileOwner はファイルの所有者を返す
+// 仮想ファイルシステム・セッションの書き込み以外のファイルの場合は空文字列を返す
+func fileOwner(info fs.FileInfo) string {
+	switch i := info.(type) {
+	case *vfsFileInfo:
+		return i.owner
+	case *overlayFileInfo:
+		return i.owner
+	default:
+		return ""
+	}
+}
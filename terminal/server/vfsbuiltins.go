@@ -0,0 +1,600 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	builtins.Register(lsBuiltin{})
+	builtins.Register(catBuiltin{})
+	builtins.Register(treeBuiltin{})
+	builtins.Register(touchBuiltin{})
+	builtins.Register(mkdirBuiltin{})
+	builtins.Register(rmBuiltin{})
+	builtins.Register(echoBuiltin{})
+}
+
+// resolvePath はコマンドの引数のパスを絶対パスに変換する
+// ~から始まるパスはホームディレクトリ、相対パスは作業ディレクトリからのパスとして扱う
+func (s *Session) resolvePath(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		p = s.homeDir() + p[1:]
+	}
+	if !path.IsAbs(p) {
+		p = path.Join(s.CurrentDir, p)
+	}
+	return path.Clean(p)
+}
+
+// parseFlags は引数を1文字のオプション（-la のようにまとめて指定できる）とそれ以外に分ける
+// allowedに含まれない文字のオプションはエラーにする
+func parseFlags(name string, args []string, allowed string) (map[rune]bool, []string, error) {
+	flags := make(map[rune]bool)
+	var operands []string
+	for i, arg := range args {
+		if arg == "--" {
+			operands = append(operands, args[i+1:]...)
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			operands = append(operands, arg)
+			continue
+		}
+		for _, c := range arg[1:] {
+			if !strings.ContainsRune(allowed, c) {
+				return nil, nil, newMessageError("builtin.invalid_option", param("command", name), param("option", "-"+string(c)))
+			}
+			flags[c] = true
+		}
+	}
+	return flags, operands, nil
+}
+
+// isHidden は隠しファイル（.から始まる名前）かどうかを返す
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// lsBuiltin は仮想ファイルシステムのディレクトリの内容を一覧表示するコマンド
+type lsBuiltin struct{}
+
+func (lsBuiltin) Name() string               { return "ls" }
+func (lsBuiltin) Usage() string              { return "ls [-a] [-l] [ファイル ...]" }
+func (lsBuiltin) Help() string               { return "ディレクトリの内容を一覧表示します" }
+func (lsBuiltin) Completion() completionKind { return completePaths }
+func (lsBuiltin) Available() bool            { return virtualFS() }
+
+func (lsBuiltin) Examples() []string {
+	return []string{"ls", "ls -la", "ls works"}
+}
+
+func (lsBuiltin) Options() []CommandOption {
+	return []CommandOption{
+		{Flag: "-a", Description: "隠しファイルも表示します"},
+		{Flag: "-l", Description: "詳細な情報を表示します"},
+	}
+}
+
+// Run は引数なしで作業ディレクトリ、引数を指定するとそのファイル・ディレクトリを表示する
+// 複数のディレクトリを指定した場合は、ディレクトリごとに見出しを付けて表示する
+func (lsBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	flags, operands, err := parseFlags("ls", args, "al")
+	if err != nil {
+		return "", err
+	}
+	if len(operands) == 0 {
+		operands = []string{"."}
+	}
+
+	var errs []error
+	var files []fs.FileInfo
+	var dirs []string
+	for _, operand := range operands {
+		info, err := session.fsys().Stat(session.resolvePath(operand))
+		if err != nil {
+			errs = append(errs, newMessageError("ls.cannot_access", param("path", operand), err))
+			continue
+		}
+		if info.IsDir() {
+			dirs = append(dirs, operand)
+		} else {
+			files = append(files, renamedFileInfo{FileInfo: info, name: operand})
+		}
+	}
+	sort.Strings(dirs)
+
+	var blocks []string
+	if len(files) > 0 {
+		blocks = append(blocks, formatLs(files, flags['l']))
+	}
+	for _, dir := range dirs {
+		entries, err := session.fsys().ReadDir(session.resolvePath(dir))
+		if err != nil {
+			errs = append(errs, newMessageError("ls.cannot_open", param("path", dir), err))
+			continue
+		}
+		var infos []fs.FileInfo
+		for _, entry := range entries {
+			if isHidden(entry.Name()) && !flags['a'] {
+				continue
+			}
+			if info, err := entry.Info(); err == nil {
+				infos = append(infos, info)
+			}
+		}
+		block := formatLs(infos, flags['l'])
+		if len(operands) > 1 {
+			block = dir + ":\n" + block
+		}
+		blocks = append(blocks, block)
+	}
+	return strings.TrimRight(strings.Join(blocks, "\n\n"), "\n"), errors.Join(errs...)
+}
+
+// renamedFileInfo は、引数に指定したパスを名前として表示するファイルの情報
+type renamedFileInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i renamedFileInfo) Name() string { return i.name }
+
+// formatLs はファイルの一覧を、1行に1件ずつ表示用に整形する
+// longの場合はモード・所有者・サイズ・更新日時を付けて表示する
+func formatLs(infos []fs.FileInfo, long bool) string {
+	if !long {
+		names := make([]string, 0, len(infos))
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		return strings.Join(names, "\n")
+	}
+
+	ownerWidth, sizeWidth := 0, 0
+	for _, info := range infos {
+		ownerWidth = max(ownerWidth, len(fileOwner(info)))
+		sizeWidth = max(sizeWidth, len(strconv.FormatInt(info.Size(), 10)))
+	}
+	lines := make([]string, 0, len(infos))
+	for _, info := range infos {
+		lines = append(lines, fmt.Sprintf("%s %-*s %*d %s %s",
+			info.Mode().String(), ownerWidth, fileOwner(info), sizeWidth, info.Size(),
+			info.ModTime().Local().Format("Jan _2 15:04"), info.Name()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// catBuiltin は仮想ファイルシステムのファイルの内容を表示するコマンド
+type catBuiltin struct{}
+
+func (catBuiltin) Name() string               { return "cat" }
+func (catBuiltin) Usage() string              { return "cat [-n] [--raw] ファイル ..." }
+func (catBuiltin) Help() string               { return "ファイルの内容を表示します" }
+func (catBuiltin) Completion() completionKind { return completePaths }
+func (catBuiltin) Available() bool            { return virtualFS() }
+
+func (catBuiltin) Examples() []string {
+	return []string{"cat introduction", "cat about.md", "cat --raw about.md", "cat photo.png", "cat -n works/HP"}
+}
+
+func (catBuiltin) Options() []CommandOption {
+	return []CommandOption{
+		{Flag: "-n", Description: "行番号を付けて表示します"},
+		{Flag: "--raw", Description: "Markdownのファイルを整形せずにそのまま表示します"},
+	}
+}
+
+// Run は指定したファイルの内容を順に連結して表示する
+// Markdownのファイル（.md）は、--rawを指定しない限り端末の幅に合わせて整形して表示する
+// 画像のファイルは、フロントエンドに画像を表示させる操作（show_image）を結果に含め、出力にはファイル名のみを表示する
+func (catBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	raw := false
+	var rest []string
+	for _, arg := range args {
+		if arg == "--raw" {
+			raw = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	flags, operands, err := parseFlags("cat", rest, "n")
+	if err != nil {
+		return "", err
+	}
+	if len(operands) == 0 {
+		return "", usageError(ctx, catBuiltin{})
+	}
+
+	var errs []error
+	var b strings.Builder
+	for _, operand := range operands {
+		data, err := session.fsys().ReadFile(session.resolvePath(operand))
+		if err != nil {
+			errs = append(errs, newMessageError("fs.error", param("command", "cat"), param("path", operand), err))
+			continue
+		}
+		if mimeType, ok := imageType(operand, data); ok {
+			name := path.Base(operand)
+			if err := emitAction(ctx, Action{Type: ActionShowImage, URL: imageDataURL(mimeType, data), Alt: name}); err != nil {
+				errs = append(errs, newMessageError("fs.error", param("command", "cat"), param("path", operand), err))
+				continue
+			}
+			b.WriteString(localize(ctx, "cat.image", name, len(data)) + "\n")
+			continue
+		}
+		if !raw && isMarkdown(operand) {
+			// 環境変数NO_COLORが設定されている場合は装飾せずに整形する
+			_, noColor := session.env["NO_COLOR"]
+			b.WriteString(renderMarkdown(string(data), session.columns(), !noColor) + "\n")
+			continue
+		}
+		b.Write(data)
+	}
+
+	output := strings.TrimRight(b.String(), "\n")
+	if flags['n'] && output != "" {
+		lines := strings.Split(output, "\n")
+		for i, line := range lines {
+			lines[i] = fmt.Sprintf("%6d\t%s", i+1, line)
+		}
+		output = strings.Join(lines, "\n")
+	}
+	return output, errors.Join(errs...)
+}
+
+// treeBuiltin は仮想ファイルシステムのディレクトリの構成をツリー状に表示するコマンド
+type treeBuiltin struct{}
+
+func (treeBuiltin) Name() string               { return "tree" }
+func (treeBuiltin) Usage() string              { return "tree [-a] [-L 深さ] [ディレクトリ]" }
+func (treeBuiltin) Help() string               { return "ディレクトリをツリー状に表示します" }
+func (treeBuiltin) Completion() completionKind { return completeDirs }
+func (treeBuiltin) Available() bool            { return virtualFS() }
+
+func (treeBuiltin) Examples() []string {
+	return []string{"tree", "tree -a ~", "tree -L 1 /"}
+}
+
+func (treeBuiltin) Options() []CommandOption {
+	return []CommandOption{
+		{Flag: "-a", Description: "隠しファイルも表示します"},
+		{Flag: "-L N", Description: "N階層までを表示します"},
+	}
+}
+
+// Run は引数なしで作業ディレクトリ、引数を指定するとそのディレクトリ以下を表示する
+func (treeBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	all, depth := false, 0
+	var operands []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-a":
+			all = true
+		case "-L":
+			if i+1 >= len(args) {
+				return "", newMessageError("tree.depth_required")
+			}
+			i++
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n <= 0 {
+				return "", newMessageError("tree.invalid_depth", param("depth", args[i]))
+			}
+			depth = n
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				return "", newMessageError("builtin.invalid_option", param("command", "tree"), param("option", args[i]))
+			}
+			operands = append(operands, args[i])
+		}
+	}
+	if len(operands) > 1 {
+		return "", usageError(ctx, treeBuiltin{})
+	}
+	root := "."
+	if len(operands) == 1 {
+		root = operands[0]
+	}
+
+	// lsと同じく、ディレクトリであることを確認してから内容を読み込む
+	dir := session.resolvePath(root)
+	info, err := session.fsys().Stat(dir)
+	if err == nil && !info.IsDir() {
+		err = &fs.PathError{Op: "tree", Path: dir, Err: errNotDir}
+	}
+	var entries []fs.DirEntry
+	if err == nil {
+		entries, err = session.fsys().ReadDir(dir)
+	}
+	if err != nil {
+		return "", newMessageError("fs.error", param("command", "tree"), param("path", root), err)
+	}
+
+	t := &treeWriter{fsys: session.fsys(), locale: localeFrom(ctx), all: all, depth: depth}
+	t.b.WriteString(root + "\n")
+	t.walk(dir, entries, "", 1)
+	t.b.WriteString("\n" + localize(ctx, "tree.summary", t.dirs, t.files))
+	return t.b.String(), nil
+}
+
+// treeWriter は、ディレクトリの構成をツリー状に書き込む構造体
+type treeWriter struct {
+	b      strings.Builder
+	fsys   FileSystem // 参照するファイルシステム
+	locale string     // エラーメッセージの言語
+	all    bool       // 隠しファイルも表示するかどうか
+	depth  int        // 表示する最大の階層（0の場合は無制限）
+	dirs   int        // 表示したディレクトリの数
+	files  int        // 表示したファイルの数
+}
+
+// walk はディレクトリの内容（entries）を再帰的に書き込む
+// prefixは罫線による字下げ、levelはルートからの階層
+// 子のディレクトリは、読み込めるかどうかの確認と内容の表示で同じ読み込み結果を使用する
+func (t *treeWriter) walk(dir string, entries []fs.DirEntry, prefix string, level int) {
+	var visible []fs.DirEntry
+	for _, entry := range entries {
+		if t.all || !isHidden(entry.Name()) {
+			visible = append(visible, entry)
+		}
+	}
+
+	for i, entry := range visible {
+		branch, next := "├── ", "│   "
+		if i == len(visible)-1 {
+			branch, next = "└── ", "    "
+		}
+		t.b.WriteString(prefix + branch + entry.Name())
+
+		if !entry.IsDir() {
+			t.files++
+			t.b.WriteString("\n")
+			continue
+		}
+		t.dirs++
+		child := path.Join(dir, entry.Name())
+		children, err := t.fsys.ReadDir(child)
+		if err != nil {
+			t.b.WriteString(" [" + fsErrorMessage(t.locale, err) + "]\n")
+			continue
+		}
+		t.b.WriteString("\n")
+		if t.depth == 0 || level < t.depth {
+			t.walk(child, children, prefix+next, level+1)
+		}
+	}
+}
+
+// writableFS はセッションの書き込みできるファイルシステムを返す
+// 書き込みが無効な場合（overlay-storeがoff）はエラーを返す
+func writableFS(session *Session) (WritableFileSystem, error) {
+	w, ok := session.fsys().(WritableFileSystem)
+	if !ok {
+		return nil, errReadOnly
+	}
+	return w, nil
+}
+
+// touchBuiltin は空のファイルを作成するコマンド
+type touchBuiltin struct{}
+
+func (touchBuiltin) Name() string               { return "touch" }
+func (touchBuiltin) Usage() string              { return "touch ファイル ..." }
+func (touchBuiltin) Help() string               { return "空のファイルを作成します" }
+func (touchBuiltin) Completion() completionKind { return completePaths }
+func (touchBuiltin) Available() bool            { return virtualFS() }
+
+// Run はファイルが存在しない場合は空のファイルを作成し、存在する場合は更新日時を更新する
+func (touchBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	if len(args) == 0 {
+		return "", usageError(ctx, touchBuiltin{})
+	}
+	w, err := writableFS(session)
+	if err != nil {
+		return "", newMessageError("error.command", param("command", "touch"), err)
+	}
+	var errs []error
+	for _, arg := range args {
+		if err := w.Touch(session.resolvePath(arg)); err != nil {
+			errs = append(errs, newMessageError("fs.error", param("command", "touch"), param("path", arg), err))
+		}
+	}
+	return "", errors.Join(errs...)
+}
+
+// mkdirBuiltin はディレクトリを作成するコマンド
+type mkdirBuiltin struct{}
+
+func (mkdirBuiltin) Name() string               { return "mkdir" }
+func (mkdirBuiltin) Usage() string              { return "mkdir [-p] ディレクトリ ..." }
+func (mkdirBuiltin) Help() string               { return "ディレクトリを作成します" }
+func (mkdirBuiltin) Completion() completionKind { return completeDirs }
+func (mkdirBuiltin) Available() bool            { return virtualFS() }
+
+func (mkdirBuiltin) Options() []CommandOption {
+	return []CommandOption{
+		{Flag: "-p", Description: "途中のディレクトリも作成し、既に存在する場合もエラーにしません"},
+	}
+}
+
+func (mkdirBuiltin) Examples() []string {
+	return []string{"mkdir notes", "mkdir -p notes/2024"}
+}
+
+// Run は指定したディレクトリを作成する
+func (mkdirBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	flags, operands, err := parseFlags("mkdir", args, "p")
+	if err != nil {
+		return "", err
+	}
+	if len(operands) == 0 {
+		return "", usageError(ctx, mkdirBuiltin{})
+	}
+	w, err := writableFS(session)
+	if err != nil {
+		return "", newMessageError("error.command", param("command", "mkdir"), err)
+	}
+
+	var errs []error
+	for _, operand := range operands {
+		dir := session.resolvePath(operand)
+		if !flags['p'] {
+			if err := w.Mkdir(dir); err != nil {
+				errs = append(errs, newMessageError("fs.error", param("command", "mkdir"), param("path", operand), err))
+			}
+			continue
+		}
+		if err := mkdirAll(w, dir); err != nil {
+			errs = append(errs, newMessageError("fs.error", param("command", "mkdir"), param("path", operand), err))
+		}
+	}
+	return "", errors.Join(errs...)
+}
+
+// mkdirAll は途中のディレクトリも含めてディレクトリを作成する
+// 既にディレクトリが存在する場合は何もしない
+func mkdirAll(w WritableFileSystem, dir string) error {
+	if info, err := w.Stat(dir); err == nil {
+		if !info.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: errNotDir}
+		}
+		return nil
+	}
+	if parent := path.Dir(dir); parent != dir {
+		if err := mkdirAll(w, parent); err != nil {
+			return err
+		}
+	}
+	return w.Mkdir(dir)
+}
+
+// rmBuiltin はファイル・ディレクトリを削除するコマンド
+type rmBuiltin struct{}
+
+func (rmBuiltin) Name() string               { return "rm" }
+func (rmBuiltin) Usage() string              { return "rm [-r] [-f] ファイル ..." }
+func (rmBuiltin) Help() string               { return "ファイルを削除します" }
+func (rmBuiltin) Completion() completionKind { return completePaths }
+func (rmBuiltin) Available() bool            { return virtualFS() }
+
+func (rmBuiltin) Options() []CommandOption {
+	return []CommandOption{
+		{Flag: "-r", Description: "ディレクトリを中身ごと削除します"},
+		{Flag: "-f", Description: "存在しないファイルを無視します"},
+	}
+}
+
+func (rmBuiltin) Examples() []string {
+	return []string{"rm note.txt", "rm -r notes"}
+}
+
+// Run は指定したファイルを削除する
+// 削除はセッションの書き込みとして記録し、元のファイルは変更しない
+func (rmBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	flags, operands, err := parseFlags("rm", args, "rRf")
+	if err != nil {
+		return "", err
+	}
+	if len(operands) == 0 {
+		if flags['f'] {
+			return "", nil
+		}
+		return "", usageError(ctx, rmBuiltin{})
+	}
+	w, err := writableFS(session)
+	if err != nil {
+		return "", newMessageError("error.command", param("command", "rm"), err)
+	}
+
+	var errs []error
+	for _, operand := range operands {
+		err := w.Remove(session.resolvePath(operand), flags['r'] || flags['R'])
+		if err == nil || (flags['f'] && errors.Is(err, fs.ErrNotExist)) {
+			continue
+		}
+		errs = append(errs, newMessageError("fs.error", param("command", "rm"), param("path", operand), err))
+	}
+	return "", errors.Join(errs...)
+}
+
+// echoBuiltin は引数を表示するコマンド
+// > ファイル・>> ファイル と組み合わせて、ファイルに書き込むために使用する
+type echoBuiltin struct{}
+
+func (echoBuiltin) Name() string               { return "echo" }
+func (echoBuiltin) Usage() string              { return "echo [文字列 ...]" }
+func (echoBuiltin) Help() string               { return "文字列を表示します" }
+func (echoBuiltin) Completion() completionKind { return completePaths }
+func (echoBuiltin) Available() bool            { return virtualFS() }
+
+func (echoBuiltin) Examples() []string {
+	return []string{"echo hello", "echo hello > note.txt", "echo world >> note.txt"}
+}
+
+// Run は引数を空白で区切って表示する
+func (echoBuiltin) Run(ctx context.Context, session *Session, args []string) (string, error) {
+	return strings.Join(args, " "), nil
+}
+
+// outputRedirect は、コマンドの出力をファイルに書き込むリダイレクト
+type outputRedirect struct {
+	target     string // 書き込むファイル（コマンドに指定したパス）
+	appendData bool   // >> の場合は末尾に追加する
+}
+
+// cutRedirect はコマンドラインから、クォートされていない > または >> 以降のリダイレクトを取り出す
+// リダイレクトがない場合はnilを返す
+func cutRedirect(line string) (string, *outputRedirect, error) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '\\':
+			i++
+		case c == '>':
+			redirect := &outputRedirect{}
+			rest := line[i+1:]
+			if strings.HasPrefix(rest, ">") {
+				redirect.appendData = true
+				rest = rest[1:]
+			}
+			args, err := splitArgs(rest)
+			if err != nil {
+				return "", nil, err
+			}
+			if len(args) != 1 {
+				return "", nil, newMessageError("redirect.target_required")
+			}
+			redirect.target = args[0]
+			return line[:i], redirect, nil
+		}
+	}
+	return line, nil, nil
+}
+
+// write はコマンドの出力をリダイレクト先のファイルに書き込む
+// 出力の末尾には改行を付ける
+func (r *outputRedirect) write(session *Session, output string) error {
+	w, err := writableFS(session)
+	if err != nil {
+		return err
+	}
+	if output != "" {
+		output += "\n"
+	}
+	return w.WriteFile(session.resolvePath(r.target), []byte(output), r.appendData)
+}
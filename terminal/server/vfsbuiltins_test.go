@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// countingFS は、ディレクトリごとのReadDirの呼び出し回数を数えるFileSystem
+type countingFS struct {
+	FileSystem
+	readDirs map[string]int
+}
+
+func (c *countingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	c.readDirs[name]++
+	return c.FileSystem.ReadDir(name)
+}
+
+func TestTree(t *testing.T) {
+	home := t.TempDir()
+	for _, dir := range []string{"a/b", "c", ".hidden"} {
+		if err := os.MkdirAll(filepath.Join(home, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"a/b/file.txt", "top.txt"} {
+		if err := os.WriteFile(filepath.Join(home, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	counting := &countingFS{FileSystem: hostFS{}, readDirs: make(map[string]int)}
+	saved := fileSystem
+	t.Cleanup(func() { fileSystem = saved })
+	fileSystem = counting
+
+	ctx := withLocale(context.Background(), "en")
+	session := &Session{CurrentDir: home}
+	tests := []struct {
+		args []string
+		want string
+		code ErrorCode // 空の場合はエラーにならない
+	}{
+		{args: nil, want: ".\n├── a\n│   └── b\n│       └── file.txt\n├── c\n└── top.txt\n\n3 directories, 2 files"},
+		{args: []string{"-L", "1"}, want: ".\n├── a\n├── c\n└── top.txt\n\n2 directories, 1 files"},
+		{args: []string{"-a", "a"}, want: "a\n└── b\n    └── file.txt\n\n1 directories, 1 files"},
+		{args: []string{"top.txt"}, code: ErrorNotADirectory},
+		{args: []string{"missing"}, code: ErrorNotFound},
+	}
+	for _, tt := range tests {
+		clear(counting.readDirs)
+		got, err := treeBuiltin{}.Run(ctx, session, tt.args)
+		if tt.code != "" {
+			if code := errorCode(err); code != tt.code {
+				t.Errorf("tree %q: errorCode = %s, want %s", tt.args, code, tt.code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("tree %q: error = %v", tt.args, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("tree %q = %q, want %q", tt.args, got, tt.want)
+		}
+		// 各ディレクトリの内容は1回だけ読み込む
+		for dir, n := range counting.readDirs {
+			if n != 1 {
+				t.Errorf("tree %q: ReadDir(%s) called %d times", tt.args, dir, n)
+			}
+		}
+	}
+}
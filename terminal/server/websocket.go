@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocketTransport は、フロントエンド（xterm.js）が直接接続するWebSocketトランスポート
+// Rails・Redisを経由せず、Payloadを受信してCommandResultを同じ接続に返す
+type WebSocketTransport struct {
+	addr      string               // 待ち受けアドレス（例: ":8080"）
+	path      string               // WebSocketエンドポイントのパス
+	server    *http.Server         // HTTPサーバー
+	upgrader  websocket.Upgrader   // HTTP→WebSocketのアップグレーダー
+	messages  chan *Message        // 受信したメッセージ
+	done      chan struct{}        // クローズ通知
+	conns     map[string]*wsConn   // セッションIDをキーとする接続マップ
+	clients   map[*wsConn]struct{} // 接続中のクライアント一覧
+	mu        sync.RWMutex         // 接続マップの排他制御用ミューテックス
+	wg        sync.WaitGroup       // 接続ハンドラーの終了待ち
+	closeOnce sync.Once            // Closeの多重実行防止
+}
+
+// wsConn は、1つのWebSocket接続を表す構造体
+// gorilla/websocketは並行書き込みを許可しないため、書き込みをミューテックスで保護する
+type wsConn struct {
+	conn *websocket.Conn // WebSocket接続
+	mu   sync.Mutex      // 書き込みの排他制御用ミューテックス
+}
+
+// NewWebSocketTransport は新しいWebSocketTransportを作成
+// allowedOriginsが空の場合は同一オリジンからの接続のみを許可する
+func NewWebSocketTransport(addr, path string, allowedOrigins []string) *WebSocketTransport {
+	t := &WebSocketTransport{
+		addr:     addr,
+		path:     path,
+		messages: make(chan *Message),
+		done:     make(chan struct{}),
+		conns:    make(map[string]*wsConn),
+		clients:  make(map[*wsConn]struct{}),
+	}
+	t.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     checkOrigin(allowedOrigins),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, t.handleWebSocket)
+	t.server = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return t
+}
+
+// checkOrigin は、WebSocket接続を許可するかどうかをOriginヘッダーで判定する関数を返す
+// allowedOriginsが空の場合は、同一オリジン（Originのホストが接続先のホストと一致する）の接続と、
+// Originヘッダーのない（ブラウザ以外からの）接続のみを許可する
+func checkOrigin(allowedOrigins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if len(allowedOrigins) == 0 {
+			if origin == "" {
+				return true
+			}
+			u, err := url.Parse(origin)
+			if err == nil && strings.EqualFold(u.Host, r.Host) {
+				return true
+			}
+		} else if slices.Contains(allowedOrigins, origin) {
+			return true
+		}
+		slog.Warn("許可されていないオリジンからのWebSocket接続を拒否", "origin", origin, "remote_addr", r.RemoteAddr)
+		return false
+	}
+}
+
+// Listen はHTTPサーバーを起動し、受信したメッセージを流すチャンネルを返す
+func (t *WebSocketTransport) Listen(ctx context.Context) (<-chan *Message, error) {
+	// ポートのバインドエラーを呼び出し元に返すため、先にリスナーを作成
+	ln, err := net.Listen("tcp", t.addr)
+	if err != nil {
+		return nil, fmt.Errorf("WebSocketサーバーの起動エラー: %w", err)
+	}
+	slog.Info("WebSocketサーバーを起動", "addr", t.addr, "path", t.path)
+
+	go func() {
+		if err := t.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("WebSocketサーバーエラー", "error", err)
+		}
+	}()
+	return t.messages, nil
+}
+
+// handleWebSocket はWebSocket接続を受け付け、切断されるまでメッセージを受信する
+func (t *WebSocketTransport) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := t.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Warn("WebSocketアップグレードエラー", "error", err, "remote_addr", r.RemoteAddr)
+		return
+	}
+
+	c := &wsConn{conn: conn}
+	if !t.addClient(c) {
+		conn.Close()
+		return
+	}
+	defer t.removeClient(c)
+	slog.Info("WebSocket接続", "remote_addr", r.RemoteAddr)
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				slog.Warn("WebSocket受信エラー", "error", err, "remote_addr", r.RemoteAddr)
+			}
+			return
+		}
+
+		// 他の接続が使用中のセッションを指定したメッセージは処理しない
+		// （出力・通知の宛先が奪われたり、他人のセッションでコマンドを実行されたりしないようにする）
+		if payload := peekPayload(data); !t.claimSession(payload.SessionID, c) {
+			slog.Warn("他の接続が使用中のセッションを指定したメッセージを拒否", "session_id", payload.SessionID, "remote_addr", r.RemoteAddr)
+			commandsRejected.WithLabelValues(reasonSessionError).Inc()
+			payload.AcceptLanguage = r.Header.Get("Accept-Language")
+			result := &CommandResult{Command: payload.Command, SessionID: payload.SessionID, RequestID: payload.RequestID}
+			result.setError(resolveLocale(payload), newMessageError("error.session_in_use"))
+			if err := c.writeJSON(result); err != nil {
+				slog.Warn("WebSocket送信エラー", "error", err, "remote_addr", r.RemoteAddr)
+				return
+			}
+			continue
+		}
+
+		m := &Message{
+			Payload:        string(data),
+			Client:         "websocket " + r.RemoteAddr,
+			Streaming:      true,
+			AcceptLanguage: r.Header.Get("Accept-Language"),
+			reply: func(ctx context.Context, result *CommandResult) error {
+				// 返信したセッションID（サーバーで生成したものを含む）とこの接続を紐づけ、Publishで宛先にできるようにする
+				t.claimSession(result.SessionID, c)
+				return c.writeJSON(result)
+			},
+		}
+		select {
+		case t.messages <- m:
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// Publish はセッションIDに紐づく接続に結果を送信する
+func (t *WebSocketTransport) Publish(ctx context.Context, result *CommandResult) error {
+	t.mu.RLock()
+	c, exists := t.conns[result.SessionID]
+	t.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("セッションに対応する接続がありません: %s", result.SessionID)
+	}
+	return c.writeJSON(result)
+}
+
+// Close はHTTPサーバーとすべての接続を閉じる
+func (t *WebSocketTransport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.done)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err = t.server.Shutdown(ctx)
+
+		// ハイジャックされたWebSocket接続はShutdownでは閉じられないため個別に閉じる
+		t.mu.Lock()
+		for c := range t.clients {
+			c.conn.Close()
+		}
+		t.mu.Unlock()
+
+		t.wg.Wait()
+		close(t.messages)
+	})
+	return err
+}
+
+// addClient は接続を登録する
+// トランスポートがクローズ済みの場合はfalseを返す
+func (t *WebSocketTransport) addClient(c *wsConn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	select {
+	case <-t.done:
+		return false
+	default:
+	}
+	t.clients[c] = struct{}{}
+	t.wg.Add(1)
+	return true
+}
+
+// removeClient は接続と、その接続に紐づくセッションの登録を削除する
+func (t *WebSocketTransport) removeClient(c *wsConn) {
+	t.mu.Lock()
+	delete(t.clients, c)
+	for sessionID, conn := range t.conns {
+		if conn == c {
+			delete(t.conns, sessionID)
+		}
+	}
+	t.mu.Unlock()
+
+	c.conn.Close()
+	t.wg.Done()
+}
+
+// claimSession はセッションIDと接続を紐づける
+// セッションは最初に指定した接続が切断されるまで、その接続のみが使用できる
+// 他の接続に紐づいている場合はfalseを返す
+func (t *WebSocketTransport) claimSession(sessionID string, c *wsConn) bool {
+	if sessionID == "" {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if owner, exists := t.conns[sessionID]; exists && owner != c {
+		return false
+	}
+	t.conns[sessionID] = c
+	return true
+}
+
+// peekPayload は、受信したメッセージをキューに入れる前にパースし、宛先のセッションを確認できるようにする
+// パースできないメッセージは空のPayloadを返す（エラーはdecodeMessageで処理する）
+func peekPayload(data []byte) *Payload {
+	var payload Payload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return &Payload{}
+	}
+	return &payload
+}
+
+// writeJSON は結果をJSONとして送信する
+func (c *wsConn) writeJSON(result *CommandResult) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := c.conn.WriteJSON(result); err != nil {
+		return fmt.Errorf("WebSocket送信エラー: %w", err)
+	}
+	return nil
+}
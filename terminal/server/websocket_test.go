@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		allowed []string
+		host    string
+		origin  string
+		want    bool
+	}{
+		{host: "localhost:8080", origin: "", want: true},
+		{host: "localhost:8080", origin: "http://localhost:8080", want: true},
+		{host: "localhost:8080", origin: "http://LOCALHOST:8080", want: true},
+		{host: "localhost:8080", origin: "http://localhost:5173", want: false},
+		{host: "localhost:8080", origin: "https://evil.example", want: false},
+		{host: "localhost:8080", origin: "null", want: false},
+		{allowed: []string{"http://localhost:5173"}, host: "localhost:8080", origin: "http://localhost:5173", want: true},
+		{allowed: []string{"http://localhost:5173"}, host: "localhost:8080", origin: "http://localhost:8080", want: false},
+		{allowed: []string{"http://localhost:5173"}, host: "localhost:8080", origin: "", want: false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "http://"+tt.host+"/ws", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := checkOrigin(tt.allowed)(r); got != tt.want {
+			t.Errorf("checkOrigin(%q)(host %q, origin %q) = %v, want %v", tt.allowed, tt.host, tt.origin, got, tt.want)
+		}
+	}
+}
+
+// TestWebSocketSessionOwner は、他の接続が使用中のセッションを指定したメッセージを拒否することを確認する
+func TestWebSocketSessionOwner(t *testing.T) {
+	tr := NewWebSocketTransport("", "/ws", nil)
+	server := httptest.NewServer(http.HandlerFunc(tr.handleWebSocket))
+	defer server.Close()
+	defer tr.Close()
+
+	dial := func() *websocket.Conn {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	receive := func() *Message {
+		t.Helper()
+		select {
+		case m := <-tr.messages:
+			return m
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+			return nil
+		}
+	}
+	command := map[string]string{"command": "pwd", "session_id": "s", "request_id": "r"}
+
+	owner, other := dial(), dial()
+	defer other.Close()
+	if err := owner.WriteJSON(command); err != nil {
+		t.Fatal(err)
+	}
+	receive()
+
+	// 他の接続からは同じセッションを使用できない
+	if err := other.WriteJSON(command); err != nil {
+		t.Fatal(err)
+	}
+	var rejected CommandResult
+	if err := other.ReadJSON(&rejected); err != nil {
+		t.Fatal(err)
+	}
+	if rejected.ErrorCode != ErrorSessionInUse || rejected.SessionID != "s" || rejected.RequestID != "r" {
+		t.Errorf("result = %+v, want %s", rejected, ErrorSessionInUse)
+	}
+
+	// セッションの出力は最初の接続に送信される
+	if err := tr.Publish(context.Background(), &CommandResult{Status: "output", SessionID: "s", Result: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	var published CommandResult
+	if err := owner.ReadJSON(&published); err != nil {
+		t.Fatal(err)
+	}
+	if published.Result != "x" {
+		t.Errorf("published = %+v", published)
+	}
+
+	// 最初の接続が切断された後は、他の接続から使用できる
+	owner.Close()
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		tr.mu.RLock()
+		_, bound := tr.conns["s"]
+		tr.mu.RUnlock()
+		if !bound {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("session not released")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := other.WriteJSON(command); err != nil {
+		t.Fatal(err)
+	}
+	receive()
+}
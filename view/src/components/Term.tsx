@@ -1,4 +1,4 @@
-import { createMemo, createSignal, onCleanup, onMount } from 'solid-js';
+import { Show, createMemo, createSignal, onCleanup, onMount } from 'solid-js';
 
 import '@xterm/xterm/css/xterm.css';
 import { createTerm } from '../hooks/createTerm';
@@ -6,12 +6,14 @@ import { createTerm } from '../hooks/createTerm';
 export function Term() {
   let container!: HTMLDivElement;
   let disposeTerm: () => void;
+  let closeImage: () => void = () => {};
   const [store, setStore] = createSignal<
     ReturnType<typeof createTerm>['store'] | null
   >(null);
 
   const isConnected = createMemo(() => store()?.isConnected ?? false);
   const isSubscribed = createMemo(() => store()?.isSubscribed ?? false);
+  const image = createMemo(() => store()?.image ?? null);
   const connectionStatus = createMemo(() => {
     if (!isConnected()) return '未接続';
     if (!isSubscribed()) return '接続中...';
@@ -19,8 +21,13 @@ export function Term() {
   });
 
   onMount(() => {
-    const { dispose, store: termStore } = createTerm(container);
+    const {
+      dispose,
+      store: termStore,
+      closeImage: close,
+    } = createTerm(container);
     disposeTerm = dispose;
+    closeImage = close;
     setStore(termStore);
   });
 
@@ -39,6 +46,24 @@ export function Term() {
         <span class="text-white">{connectionStatus()}</span>
       </div>
       <div ref={(el) => (container = el!)} class="h-[500px] w-full" />
+      <Show when={image()}>
+        {(img) => (
+          <div class="mt-2 flex items-start gap-2">
+            <img
+              src={img().src}
+              alt={img().alt}
+              class="max-h-[300px] max-w-full rounded"
+            />
+            <button
+              type="button"
+              class="text-white"
+              onClick={() => closeImage()}
+            >
+              ×
+            </button>
+          </div>
+        )}
+      </Show>
     </div>
   );
 }
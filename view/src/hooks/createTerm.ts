@@ -17,9 +17,11 @@ import {
   WS_RECONNECT_CONFIG,
   WS_URL,
   WebSocketMessageSchema,
+  isHttpUrl,
 } from '../types/terminal';
 
 import type {
+  Action,
   TerminalReturn,
   TerminalState,
   WebSocketError,
@@ -52,6 +54,7 @@ import type {
  * - commandHistory: コマンド履歴の配列
  * - historyIndex: コマンド履歴の現在の位置
  * - isProcessingCommand: コマンド実行中かどうか
+ * - image: ターミナルの下に表示する画像（表示しない場合はnull）
  */
 function createInitialState(): TerminalState {
   return TerminalStateSchema.parse({
@@ -63,6 +66,7 @@ function createInitialState(): TerminalState {
     commandHistory: [],
     historyIndex: -1,
     isProcessingCommand: false,
+    image: null,
   });
 }
 
@@ -141,6 +145,52 @@ function createWebSocketManager(
     setStore(() => update);
   };
 
+  /**
+   * サーバーから指示された操作を実行する関数
+   *
+   * 操作の種類:
+   * - clear: 画面とスクロールバック、表示中の画像を消去
+   * - open_url: URLを新しいタブで開く
+   * - show_image: 画像をターミナルの下に表示
+   *
+   * 注意:
+   * - サーバーで許可リストによる検証を行っているが、念のためURLの形式を確認する
+   * - ポップアップがブロックされた場合も、出力に表示されたリンクから開ける
+   *
+   * @returns {boolean} 画面を消去したかどうか
+   */
+  const runActions = (actions: Action[]): boolean => {
+    let cleared = false;
+    for (const action of actions) {
+      switch (action.type) {
+        case 'clear':
+          term.clear();
+          updateState({ image: null });
+          cleared = true;
+          break;
+        case 'open_url':
+          if (action.url && isHttpUrl(action.url)) {
+            window.open(action.url, '_blank', 'noopener,noreferrer');
+          }
+          break;
+        case 'show_image':
+          if (
+            action.url &&
+            (action.url.startsWith('data:image/') || isHttpUrl(action.url))
+          ) {
+            updateState({
+              image: { src: action.url, alt: action.alt ?? '' },
+            });
+          }
+          break;
+        default:
+          // 未知の操作は無視する
+          break;
+      }
+    }
+    return cleared;
+  };
+
   /**
    * WebSocketメッセージを処理する関数
    *
@@ -151,7 +201,8 @@ function createWebSocketManager(
    *    - pwd: 現在のディレクトリを更新
    *    - username: ユーザー名を更新
    *    - error: エラーメッセージを表示
-   *    - result: コマンド実行結果を表示
+   *    - actions: 画面の消去・URLを開く・画像の表示などの操作を実行
+   *    - result: コマンド実行結果を表示（画面を消去した場合は表示しない）
    *      - lsコマンドの場合は特別な表示処理を実施
    * 2. メッセージが文字列の場合:
    *    - そのままターミナルに表示
@@ -171,12 +222,14 @@ function createWebSocketManager(
         updateState({ username: data.message.username });
       }
 
+      const cleared = runActions(data.message.actions ?? []);
+
       if ('error' in data.message && typeof data.message.error === 'string') {
         term.write(`\x1b[31m❌ エラー: ${data.message.error}\x1b[0m\r\n`);
         if (data.message.result?.trim()) {
           term.write(data.message.result + '\r\n');
         }
-      } else if (data.message.result?.trim()) {
+      } else if (!cleared && data.message.result?.trim()) {
         // lsコマンドの出力を特別に処理
         const command = data.message.command ?? '';
         if (typeof command === 'string' && command.trim().startsWith('ls')) {
@@ -672,10 +725,16 @@ export function createTerm(container: HTMLDivElement): TerminalReturn {
 
   onCleanup(dispose);
 
+  // 表示中の画像を閉じる関数
+  const closeImage = () => {
+    setStore(() => ({ image: null }));
+  };
+
   return {
     term,
     store,
     dispose,
     executeCommand,
+    closeImage,
   };
 }
@@ -1,6 +1,16 @@
 import { Terminal } from '@xterm/xterm';
 import { z } from 'zod';
 
+// サーバーから指示される操作のスキーマ
+// 未知の種類の操作でメッセージ全体が破棄されないよう、種類は文字列として受け取る
+export const ActionSchema = z.object({
+  type: z.string(),
+  url: z.string().optional(),
+  alt: z.string().optional(),
+});
+
+export type Action = z.infer<typeof ActionSchema>;
+
 // WebSocketメッセージのスキーマ
 export const WebSocketMessageSchema = z.object({
   type: z.string().optional(),
@@ -12,6 +22,7 @@ export const WebSocketMessageSchema = z.object({
         pwd: z.string().optional(),
         username: z.string().optional(),
         command: z.string().optional(),
+        actions: z.array(ActionSchema).optional(),
       }),
       z.string(),
       z.number(),
@@ -41,6 +52,12 @@ export const TerminalStateSchema = z.object({
   commandHistory: z.array(z.string()),
   historyIndex: z.number(),
   isProcessingCommand: z.boolean(),
+  image: z
+    .object({
+      src: z.string(),
+      alt: z.string(),
+    })
+    .nullable(),
 });
 
 export type TerminalState = z.infer<typeof TerminalStateSchema>;
@@ -51,6 +68,7 @@ export interface TerminalReturn {
   store: TerminalState;
   dispose: () => void;
   executeCommand: (command: string) => void;
+  closeImage: () => void;
 }
 
 // 定数
@@ -62,11 +80,29 @@ export const WS_HOST =
     : '192.168.97.1';
 export const WS_URL = `ws://${WS_HOST}:8000/api/v1/cable`;
 
+// http / https のURLかどうか（開くURLの確認に使用）
+export function isHttpUrl(url: string): boolean {
+  try {
+    const { protocol } = new URL(url);
+    return protocol === 'https:' || protocol === 'http:';
+  } catch {
+    return false;
+  }
+}
+
 // ターミナルの設定
+// OSC 8のハイパーリンクは、http / https のURLのみ新しいタブで開く
 export const TERMINAL_OPTIONS = {
   convertEol: true,
   cursorBlink: true,
   allowProposedApi: true,
+  linkHandler: {
+    activate: (_event: MouseEvent, uri: string) => {
+      if (isHttpUrl(uri)) {
+        window.open(uri, '_blank', 'noopener,noreferrer');
+      }
+    },
+  },
 } as const;
 
 // コマンドのバリデーションスキーマ